@@ -2,12 +2,16 @@
 package analyze
 
 import (
-	"bufio"
-	"encoding/json"
+	"cmp"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"sort"
+	"iter"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/stevenctl/deadlog"
 )
@@ -18,6 +22,22 @@ type LockInfo struct {
 	Name  string // mutex name
 	ID    int    // correlation ID
 	Trace string // stack trace if available
+
+	Frames []deadlog.Frame // structured stack frames if available
+
+	PCs     []uintptr // raw program counters if available, see Symbolizer
+	BuildID string    // build ID of the binary the PCs belong to
+
+	Ts int64 // unix nanoseconds of the START (stuck) or ACQUIRED (held) event
+
+	Source string // process or file the event came from, see WithSource
+	Prefix string // text before the event on its log line, see Events
+
+	Package string // package of the test that logged the event, for go test -json input
+	Test    string // test that logged the event, for go test -json input
+
+	Goroutine int64      // ID of the goroutine if logged, see deadlog.WithGoroutineID
+	Stack     *Goroutine // the goroutine in a dump of the hung process, see MatchGoroutines
 }
 
 // isTrackedType returns true if the lock type tracks RELEASED events.
@@ -31,91 +51,76 @@ type Result struct {
 	Stuck []LockInfo
 	// Held contains locks that acquired but never released (holding lock).
 	Held []LockInfo
+	// Malformed contains the lines that looked like events but couldn't be
+	// decoded, with the file each is in, if known, and its error.
+	Malformed []LineError
+	// Sessions contains the process runs found in the log, delimited by
+	// HEADER events. Stuck and Held only cover the current run of each
+	// source; ended runs keep what was outstanding when they restarted.
+	Sessions []Session
+	// Cycles contains the locks that were acquired in inconsistent order,
+	// which can deadlock even if this log doesn't show it.
+	Cycles []Cycle
+	// Blocked contains the goroutines of a dump that wait on a lock but
+	// match no stuck operation, see MatchGoroutines.
+	Blocked []Goroutine
 }
 
 // Analyze reads deadlog JSON events from r and returns analysis results.
 func Analyze(r io.Reader) (*Result, error) {
-	starts := make(map[string]*LockInfo)
-	acquires := make(map[string]*LockInfo)
-	releases := make(map[string]struct{})
-
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-
-		var e deadlog.Event
-		if err := json.Unmarshal(line, &e); err != nil {
-			// Skip non-JSON lines
-			continue
-		}
+	return AnalyzeEvents(ResolveTraces(Events(r)))
+}
 
-		key := fmt.Sprintf("%s|%s|%d", e.Type, e.Name, e.ID)
+// AnalyzeEvents returns analysis results for a stream of events, such as one
+// built from Events with Filter and Map. A *LineError is recorded in
+// Result.Malformed; any other error aborts the analysis.
+func AnalyzeEvents(events iter.Seq2[deadlog.Event, error]) (*Result, error) {
+	tracker := NewTracker()
+	var malformed []LineError
 
-		switch e.State {
-		case "START":
-			starts[key] = &LockInfo{
-				Type:  e.Type,
-				Name:  e.Name,
-				ID:    e.ID,
-				Trace: e.Trace,
-			}
-		case "ACQUIRED":
-			acquires[key] = &LockInfo{
-				Type:  e.Type,
-				Name:  e.Name,
-				ID:    e.ID,
-				Trace: e.Trace,
+	for e, err := range events {
+		if err != nil {
+			var lineErr *LineError
+			if errors.As(err, &lineErr) {
+				malformed = append(malformed, *lineErr)
+				continue
 			}
-		case "RELEASED":
-			releases[key] = struct{}{}
+			return nil, err
 		}
+		tracker.Observe(e)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-
-	result := &Result{}
+	result := tracker.Result()
+	result.SetMalformed(malformed)
+	return result, nil
+}
 
-	// Find stuck: started but never acquired
-	for key, info := range starts {
-		if _, acquired := acquires[key]; !acquired {
-			result.Stuck = append(result.Stuck, *info)
-		}
-	}
+// SetMalformed records the lines that couldn't be decoded in Malformed,
+// sorted by file and line.
+func (r *Result) SetMalformed(lines []LineError) {
+	slices.SortStableFunc(lines, func(a, b LineError) int {
+		return cmp.Or(strings.Compare(a.Source, b.Source), cmp.Compare(a.Line, b.Line))
+	})
+	r.Malformed = lines
+}
 
-	// Find held: acquired but never released (only for tracked types)
-	for key, info := range acquires {
-		if !isTrackedType(info.Type) {
-			continue // WLOCK/RWLOCK don't track RELEASED, skip them
-		}
-		if _, released := releases[key]; !released {
-			result.Held = append(result.Held, *info)
+// MalformedString lists the malformed lines, as "3, 5" for a single input
+// and as "a.log:3, b.log:5" where their files are known.
+func (r *Result) MalformedString() string {
+	parts := make([]string, len(r.Malformed))
+	for i, l := range r.Malformed {
+		parts[i] = strconv.Itoa(l.Line)
+		if l.Source != "" {
+			parts[i] = l.Source + ":" + parts[i]
 		}
 	}
-
-	// Sort for deterministic output
-	sort.Slice(result.Stuck, func(i, j int) bool {
-		return result.Stuck[i].ID < result.Stuck[j].ID
-	})
-	sort.Slice(result.Held, func(i, j int) bool {
-		return result.Held[i].ID < result.Held[j].ID
-	})
-
-	return result, nil
+	return strings.Join(parts, ", ")
 }
 
-// AnalyzeFile reads deadlog JSON events from a file and returns analysis results.
+// AnalyzeFile reads deadlog JSON events from a file and returns analysis
+// results. The file may be gzip-compressed.
 func AnalyzeFile(path string) (*Result, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	return Analyze(f)
+	return AnalyzeFiles(path)
 }
 
 // PrintReport prints a human-readable report of the analysis results.
@@ -126,41 +131,185 @@ func PrintReport(w io.Writer, r *Result) {
 	fmt.Fprintln(w)
 
 	fmt.Fprintln(w, "=== STUCK: Started but never acquired (waiting for lock) ===")
-	if len(r.Stuck) == 0 {
-		fmt.Fprintln(w, "  (none)")
-	} else {
-		for _, info := range r.Stuck {
-			name := info.Name
-			if name == "" {
-				name = "(unnamed)"
-			}
-			fmt.Fprintf(w, "  %-5s | %-20s | ID: %d\n", info.Type, name, info.ID)
-			if info.Trace != "" {
-				fmt.Fprintf(w, "         Trace: %s\n", info.Trace)
-			}
-		}
-	}
+	printLocks(w, r.Stuck)
 	fmt.Fprintln(w)
 
 	fmt.Fprintln(w, "=== HELD: Acquired but never released (holding lock) ===")
-	if len(r.Held) == 0 {
-		fmt.Fprintln(w, "  (none)")
-	} else {
-		for _, info := range r.Held {
-			name := info.Name
-			if name == "" {
-				name = "(unnamed)"
-			}
-			fmt.Fprintf(w, "  %-5s | %-20s | ID: %d\n", info.Type, name, info.ID)
-			if info.Trace != "" {
-				fmt.Fprintf(w, "         Trace: %s\n", info.Trace)
-			}
+	printLocks(w, r.Held)
+	fmt.Fprintln(w)
+
+	if groups := GroupByStack(r); len(groups) > 0 {
+		fmt.Fprintln(w, "=== BY STACK: Findings grouped by acquisition stack ===")
+		for _, g := range groups {
+			fmt.Fprintf(w, "  Stuck: %d, Held: %d\n", len(g.Stuck), len(g.Held))
+			printFrames(w, g.Frames)
 		}
+		fmt.Fprintln(w)
+	}
+
+	if len(r.Cycles) > 0 {
+		fmt.Fprintln(w, "=== CYCLES: Locks acquired in inconsistent order (potential deadlock) ===")
+		for _, c := range r.Cycles {
+			printCycle(w, c)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(r.Sessions) > 0 {
+		fmt.Fprintln(w, "=== SESSIONS: Process runs in the log ===")
+		for _, s := range r.Sessions {
+			printSession(w, s)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(r.Blocked) > 0 {
+		fmt.Fprintln(w, "=== BLOCKED: Goroutines waiting on a lock without a stuck event ===")
+		for _, g := range r.Blocked {
+			printGoroutine(w, g)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(r.Malformed) > 0 {
+		fmt.Fprintln(w, "=== MALFORMED: Lines that could not be decoded ===")
+		fmt.Fprintf(w, "  Lines: %s\n", r.MalformedString())
+		fmt.Fprintln(w)
 	}
-	fmt.Fprintln(w)
 
 	fmt.Fprintln(w, "=== SUMMARY ===")
 	fmt.Fprintf(w, "  Stuck waiting: %d\n", len(r.Stuck))
 	fmt.Fprintf(w, "  Held:          %d\n", len(r.Held))
 	fmt.Fprintln(w)
 }
+
+// PrintAlert prints a human-readable alert for an overdue lock.
+func PrintAlert(w io.Writer, a Alert) {
+	verb := "waiting"
+	if a.Kind == AlertHold {
+		verb = "held"
+	}
+	at := time.Unix(0, a.Lock.Ts).Add(a.Duration)
+	fmt.Fprintf(w, "[%s] %s: %s for %s\n", at.Format(time.RFC3339), a.Kind, verb, a.Duration.Round(time.Millisecond))
+	printLocks(w, []LockInfo{a.Lock})
+	if a.Kind == AlertWait {
+		if len(a.Blockers) == 0 {
+			fmt.Fprintln(w, "  Blocked by: (unknown)")
+		} else {
+			fmt.Fprintln(w, "  Blocked by:")
+			printLocks(w, a.Blockers)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+func printSession(w io.Writer, s Session) {
+	h := s.Header
+	status := "current"
+	if s.Ended {
+		status = "restarted"
+	}
+	if h == nil {
+		fmt.Fprintf(w, "  unknown process before the first header (%s)\n", status)
+	} else {
+		fmt.Fprintf(w, "  pid %d on %s, started %s (%s)\n", h.PID, h.Hostname, time.Unix(0, h.Start).UTC().Format(time.RFC3339), status)
+	}
+	if s.Source != "" {
+		fmt.Fprintf(w, "         Source: %s\n", s.Source)
+	}
+	if s.Package != "" {
+		fmt.Fprintf(w, "         Package: %s\n", s.Package)
+	}
+	if h != nil {
+		fmt.Fprintf(w, "         Binary: %s (%s)\n", h.Executable, h.GoVersion)
+		if len(h.Labels) > 0 {
+			keys := slices.Sorted(maps.Keys(h.Labels))
+			labels := make([]string, len(keys))
+			for i, k := range keys {
+				labels[i] = k + "=" + h.Labels[k]
+			}
+			fmt.Fprintf(w, "         Labels: %s\n", strings.Join(labels, ", "))
+		}
+	}
+	if s.Ended && len(s.Stuck)+len(s.Held) > 0 {
+		fmt.Fprintf(w, "         Outstanding at restart: %d stuck, %d held\n", len(s.Stuck), len(s.Held))
+		if len(s.Stuck) > 0 {
+			printLocks(w, s.Stuck)
+		}
+		if len(s.Held) > 0 {
+			printLocks(w, s.Held)
+		}
+	}
+}
+
+func printCycle(w io.Writer, c Cycle) {
+	fmt.Fprintf(w, "  %s\n", strings.Join(c.Names(), " -> "))
+	if c.Source != "" {
+		fmt.Fprintf(w, "         Source: %s\n", c.Source)
+	}
+	if c.Package != "" {
+		fmt.Fprintf(w, "         Package: %s\n", c.Package)
+	}
+	for _, e := range c.Edges {
+		fmt.Fprintf(w, "         %s taken while holding %s (goroutine %d):\n", e.Wanted.Name, e.Held.Name, e.Wanted.Goroutine)
+		if len(e.Wanted.Frames) > 0 {
+			printFrames(w, e.Wanted.Frames)
+		} else if e.Wanted.Trace != "" {
+			fmt.Fprintf(w, "           %s\n", e.Wanted.Trace)
+		}
+	}
+}
+
+func printLocks(w io.Writer, infos []LockInfo) {
+	if len(infos) == 0 {
+		fmt.Fprintln(w, "  (none)")
+		return
+	}
+	for _, info := range infos {
+		name := info.Name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		fmt.Fprintf(w, "  %-5s | %-20s | ID: %d\n", info.Type, name, info.ID)
+		if info.Source != "" {
+			fmt.Fprintf(w, "         Source: %s\n", info.Source)
+		}
+		if info.Test != "" {
+			fmt.Fprintf(w, "         Test: %s (%s)\n", info.Test, info.Package)
+		} else if info.Package != "" {
+			fmt.Fprintf(w, "         Package: %s\n", info.Package)
+		}
+		if info.Prefix != "" {
+			fmt.Fprintf(w, "         Prefix: %s\n", info.Prefix)
+		}
+		if len(info.Frames) > 0 {
+			fmt.Fprintln(w, "         Frames:")
+			printFrames(w, info.Frames)
+		} else if info.Trace != "" {
+			fmt.Fprintf(w, "         Trace: %s\n", info.Trace)
+		}
+		if info.Stack != nil {
+			printGoroutine(w, *info.Stack)
+		}
+	}
+}
+
+func printGoroutine(w io.Writer, g Goroutine) {
+	state := g.State
+	if g.Wait > 0 {
+		state += ", blocked " + g.Wait.String()
+	}
+	fmt.Fprintf(w, "         Goroutine %d [%s]:\n", g.ID, state)
+	printFrames(w, g.Frames)
+	if g.CreatedBy != nil {
+		fmt.Fprintf(w, "           created by %s\n", g.CreatedBy.Func)
+		fmt.Fprintf(w, "               %s:%d\n", g.CreatedBy.File, g.CreatedBy.Line)
+	}
+}
+
+func printFrames(w io.Writer, frames []deadlog.Frame) {
+	for _, f := range frames {
+		fmt.Fprintf(w, "           %s\n", f.Func)
+		fmt.Fprintf(w, "               %s:%d\n", f.File, f.Line)
+	}
+}
@@ -206,6 +206,75 @@ func TestAnalyze_WithTrace(t *testing.T) {
 	m.Unlock()
 }
 
+func TestAnalyze_WithFrames(t *testing.T) {
+	var buf bytes.Buffer
+	m := deadlog.New(
+		deadlog.WithName("frames-test"),
+		deadlog.WithFrames(2),
+		deadlog.WithLogger(deadlog.WriterLogger(&buf)),
+	)
+
+	_ = m.LockFunc() // ignore unlock function
+
+	result, err := Analyze(&buf)
+	if err != nil {
+		t.Fatalf("Analyze error: %v", err)
+	}
+
+	if len(result.Held) != 1 {
+		t.Fatalf("expected 1 held lock, got %d", len(result.Held))
+	}
+	frames := result.Held[0].Frames
+	if len(frames) == 0 {
+		t.Fatal("expected frames to be present")
+	}
+	if frames[0].Func != "github.com/stevenctl/deadlog/analyze.TestAnalyze_WithFrames" {
+		t.Errorf("expected fully-qualified function, got %q", frames[0].Func)
+	}
+
+	var report bytes.Buffer
+	PrintReport(&report, result)
+	if !strings.Contains(report.String(), "github.com/stevenctl/deadlog/analyze.TestAnalyze_WithFrames") {
+		t.Error("report should contain the fully-qualified frame")
+	}
+	if !strings.Contains(report.String(), "BY STACK") {
+		t.Error("report should group findings by stack")
+	}
+
+	m.Unlock()
+}
+
+func TestAnalyze_InternedTraces(t *testing.T) {
+	var buf bytes.Buffer
+	m := deadlog.New(
+		deadlog.WithName("interned"),
+		deadlog.WithTrace(2),
+		deadlog.WithFrames(2),
+		deadlog.WithLogger(deadlog.InternTraces(deadlog.WriterLogger(&buf))),
+	)
+
+	unlock := m.LockFunc()
+	unlock()
+	_ = m.LockFunc() // ignore unlock function
+
+	result, err := Analyze(&buf)
+	if err != nil {
+		t.Fatalf("Analyze error: %v", err)
+	}
+
+	if len(result.Held) != 1 {
+		t.Fatalf("expected 1 held lock, got %d", len(result.Held))
+	}
+	if result.Held[0].Trace == "" || len(result.Held[0].Frames) == 0 {
+		t.Error("expected the interned stack to be resolved")
+	}
+	if len(result.Stuck) != 0 {
+		t.Errorf("TRACE definitions should not be treated as locks, got %d stuck", len(result.Stuck))
+	}
+
+	m.Unlock()
+}
+
 func TestAnalyze_MultipleIssues(t *testing.T) {
 	var buf bytes.Buffer
 	logger := deadlog.WriterLogger(&buf)
@@ -267,6 +336,37 @@ also not json
 	}
 }
 
+func TestAnalyze_ReportsMalformedLines(t *testing.T) {
+	input := `not json
+{"type":"LOCK","state":"START","name":"test","id":123,"ts":1234567890}
+{"type":"LOCK","state":"ACQUIRED","name":"test","id":123,
+{"type":"LOCK","state":"ACQUIRED","name":"test","id":123,"ts":1234567891}
+{truncated
+`
+	result, err := Analyze(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Analyze error: %v", err)
+	}
+
+	if len(result.Held) != 1 {
+		t.Errorf("expected 1 held lock, got %d", len(result.Held))
+	}
+	if len(result.Malformed) != 2 || result.Malformed[0].Line != 3 || result.Malformed[1].Line != 5 {
+		t.Errorf("expected malformed lines [3 5], got %v", result.Malformed)
+	}
+	for _, l := range result.Malformed {
+		if l.Source != "" || l.Err == nil {
+			t.Errorf("expected an error without a file, got %+v", l)
+		}
+	}
+
+	var buf bytes.Buffer
+	PrintReport(&buf, result)
+	if !strings.Contains(buf.String(), "Lines: 3, 5") {
+		t.Error("report should list malformed lines")
+	}
+}
+
 func TestPrintReport(t *testing.T) {
 	result := &Result{
 		Stuck: []LockInfo{
@@ -0,0 +1,168 @@
+package analyze
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// chromeTrace is the JSON object form of the Trace Event Format, understood
+// by Perfetto and chrome://tracing.
+type chromeTrace struct {
+	TraceEvents     []chromeEvent `json:"traceEvents"`
+	DisplayTimeUnit string        `json:"displayTimeUnit"`
+}
+
+type chromeEvent struct {
+	Name  string         `json:"name"`
+	Cat   string         `json:"cat,omitempty"`
+	Ph    string         `json:"ph"`
+	Ts    chromeTime     `json:"ts"`
+	Dur   *chromeTime    `json:"dur,omitempty"`
+	Pid   int            `json:"pid"`
+	Tid   int            `json:"tid"`
+	Scope string         `json:"s,omitempty"`
+	Args  map[string]any `json:"args,omitempty"`
+}
+
+// chromeTime is a time in nanoseconds, written as microseconds with three
+// decimals so that it keeps nanosecond precision, which a float64 of
+// microseconds since the epoch doesn't.
+type chromeTime int64
+
+func (t chromeTime) MarshalJSON() ([]byte, error) {
+	return fmt.Appendf(nil, "%d.%03d", t/1e3, t%1e3), nil
+}
+
+// chromePid is the process all deadlog tracks are grouped under.
+const chromePid = 1
+
+// chromeTrack identifies a track: a goroutine if the operations on it were
+// logged WithGoroutineID, and a lock name otherwise.
+type chromeTrack struct {
+	goroutine int64
+	name      string
+}
+
+func (t chromeTrack) String() string {
+	if t.goroutine != 0 {
+		return fmt.Sprintf("goroutine %d", t.goroutine)
+	}
+	return displayName(t.name)
+}
+
+// WriteChromeTrace writes spans in the Trace Event Format, for viewing in
+// Perfetto or chrome://tracing. Operations logged WithGoroutineID are put on
+// a track per goroutine, so a goroutine's waits show up next to the locks it
+// holds; other operations get a track per lock name. Tracks are split into
+// numbered tracks where operations overlap. A wait becomes a "wait" slice
+// from START to ACQUIRED and a hold a "hold" slice from ACQUIRED to RELEASED,
+// suffixed with the lock name on goroutine tracks; slices still open at the
+// end of the log end at the last event and are marked outstanding. Untracked
+// acquisitions are instant events. Timestamps are absolute, with nanosecond
+// precision, so the output lines up with other traces.
+func WriteChromeTrace(w io.Writer, spans []Span) error {
+	trace := chromeTrace{TraceEvents: []chromeEvent{}, DisplayTimeUnit: "ns"}
+	_, end := timeRange(spans)
+
+	byTrack := make(map[chromeTrack][]Span)
+	for _, s := range spans {
+		track := chromeTrack{goroutine: s.Goroutine}
+		if s.Goroutine == 0 {
+			track.name = s.Name
+		}
+		byTrack[track] = append(byTrack[track], s)
+	}
+	tracks := make([]chromeTrack, 0, len(byTrack))
+	for track := range byTrack {
+		tracks = append(tracks, track)
+	}
+	// Goroutines first, by ID, then lock names.
+	sort.Slice(tracks, func(i, j int) bool {
+		a, b := tracks[i], tracks[j]
+		if (a.goroutine == 0) != (b.goroutine == 0) {
+			return a.goroutine != 0
+		}
+		if a.goroutine != b.goroutine {
+			return a.goroutine < b.goroutine
+		}
+		return a.name < b.name
+	})
+
+	tid := 0
+	for _, track := range tracks {
+		rows, n := packRows(byTrack[track], end)
+		for row := range n {
+			name := track.String()
+			if row > 0 {
+				name = fmt.Sprintf("%s (%d)", name, row+1)
+			}
+			trace.TraceEvents = append(trace.TraceEvents,
+				chromeEvent{Name: "thread_name", Ph: "M", Pid: chromePid, Tid: tid + row, Args: map[string]any{"name": name}},
+				chromeEvent{Name: "thread_sort_index", Ph: "M", Pid: chromePid, Tid: tid + row, Args: map[string]any{"sort_index": tid + row}},
+			)
+		}
+		for i, s := range byTrack[track] {
+			for _, seg := range spanSegments(s, end) {
+				e := chromeSlice(s, seg, tid+rows[i])
+				if track.goroutine != 0 {
+					e.Name += " " + displayName(s.Name)
+				}
+				trace.TraceEvents = append(trace.TraceEvents, e)
+			}
+		}
+		tid += n
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(trace)
+}
+
+// chromeSlice converts a span segment into a trace event.
+func chromeSlice(s Span, seg segment, tid int) chromeEvent {
+	args := map[string]any{
+		"type": s.Type,
+		"name": s.Name,
+		"id":   s.ID,
+	}
+	if s.Goroutine != 0 {
+		args["goroutine"] = s.Goroutine
+	}
+	if len(s.Frames) > 0 {
+		frames := make([]string, len(s.Frames))
+		for i, f := range s.Frames {
+			frames[i] = f.String()
+		}
+		args["frames"] = frames
+	} else if s.Trace != "" {
+		args["trace"] = s.Trace
+	}
+
+	e := chromeEvent{
+		Cat:  "deadlog",
+		Ph:   "X",
+		Ts:   chromeTime(seg.from),
+		Pid:  chromePid,
+		Tid:  tid,
+		Args: args,
+	}
+	switch seg.class {
+	case "wait", "stuck":
+		e.Name = "wait"
+	case "hold", "held":
+		e.Name = "hold"
+	case "untracked":
+		e.Name = "acquire"
+		e.Ph = "i"
+		e.Scope = "t"
+		return e
+	}
+	if seg.class == "stuck" || seg.class == "held" {
+		args["outstanding"] = true
+	}
+	dur := chromeTime(seg.to - seg.from)
+	e.Dur = &dur
+	return e
+}
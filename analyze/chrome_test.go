@@ -0,0 +1,132 @@
+package analyze
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testChromeTrace decodes a trace written by WriteChromeTrace, keeping times
+// as written, in microseconds.
+type testChromeTrace struct {
+	TraceEvents []testChromeEvent `json:"traceEvents"`
+}
+
+type testChromeEvent struct {
+	Name string         `json:"name"`
+	Ph   string         `json:"ph"`
+	Ts   json.Number    `json:"ts"`
+	Dur  *json.Number   `json:"dur"`
+	Tid  int            `json:"tid"`
+	Args map[string]any `json:"args"`
+}
+
+func TestWriteChromeTrace(t *testing.T) {
+	input := `{"type":"LOCK","state":"START","name":"a","id":1,"trace":"f:1","ts":1000000}
+{"type":"LOCK","state":"ACQUIRED","name":"a","id":1,"trace":"f:1","ts":1002000}
+{"type":"LOCK","state":"START","name":"a","id":2,"trace":"g:2","ts":1003000}
+{"type":"LOCK","state":"RELEASED","name":"a","id":1,"ts":1005000}
+{"type":"WLOCK","state":"ACQUIRED","name":"b","id":3,"ts":1004000}
+`
+	spans, err := Spans(Events(strings.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteChromeTrace(&buf, spans); err != nil {
+		t.Fatalf("WriteChromeTrace error: %v", err)
+	}
+
+	var trace testChromeTrace
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	tracks := make(map[int]string)
+	var slices []testChromeEvent
+	for _, e := range trace.TraceEvents {
+		switch {
+		case e.Ph == "M" && e.Name == "thread_name":
+			tracks[e.Tid] = e.Args["name"].(string)
+		case e.Ph != "M":
+			slices = append(slices, e)
+		}
+	}
+	// ID 2 starts while ID 1 is held, so "a" needs a second track.
+	if len(tracks) != 3 || tracks[0] != "a" || tracks[1] != "a (2)" || tracks[2] != "b" {
+		t.Errorf("unexpected tracks: %v", tracks)
+	}
+	if len(slices) != 4 {
+		t.Fatalf("expected 4 slices, got %d: %+v", len(slices), slices)
+	}
+
+	wait, hold, stuck, acquire := slices[0], slices[1], slices[2], slices[3]
+	if wait.Name != "wait" || wait.Ts != "1000.000" || *wait.Dur != "2.000" || wait.Tid != 0 {
+		t.Errorf("unexpected wait slice: %+v", wait)
+	}
+	if wait.Args["trace"] != "f:1" || wait.Args["id"] != float64(1) {
+		t.Errorf("unexpected wait args: %v", wait.Args)
+	}
+	if hold.Name != "hold" || hold.Ts != "1002.000" || *hold.Dur != "3.000" || hold.Tid != 0 {
+		t.Errorf("unexpected hold slice: %+v", hold)
+	}
+	if stuck.Name != "wait" || stuck.Tid != 1 || stuck.Args["outstanding"] != true || *stuck.Dur != "2.000" {
+		t.Errorf("expected an outstanding wait until the last event, got %+v", stuck)
+	}
+	if acquire.Ph != "i" || acquire.Tid != 2 {
+		t.Errorf("expected an instant event for the untracked lock, got %+v", acquire)
+	}
+}
+
+func TestWriteChromeTrace_Goroutines(t *testing.T) {
+	// Goroutine 7 waits for b while holding a; the unnamed lock has no
+	// goroutine and keeps a track of its own.
+	ts := int64(1_700_000_000_123_456_789)
+	input := fmt.Sprintf(`{"type":"LOCK","state":"ACQUIRED","name":"a","id":1,"goroutine":7,"ts":%d}
+{"type":"LOCK","state":"START","name":"b","id":2,"goroutine":7,"ts":%d}
+{"type":"LOCK","state":"START","id":3,"ts":%d}
+`, ts, ts+1, ts+2)
+	spans, err := Spans(Events(strings.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteChromeTrace(&buf, spans); err != nil {
+		t.Fatalf("WriteChromeTrace error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"ts": 1700000000123456.789`) {
+		t.Errorf("expected a timestamp with nanosecond precision, got:\n%s", buf.String())
+	}
+
+	var trace testChromeTrace
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	tracks := make(map[int]string)
+	var slices []testChromeEvent
+	for _, e := range trace.TraceEvents {
+		switch {
+		case e.Ph == "M" && e.Name == "thread_name":
+			tracks[e.Tid] = e.Args["name"].(string)
+		case e.Ph != "M":
+			slices = append(slices, e)
+		}
+	}
+	if len(tracks) != 3 || tracks[0] != "goroutine 7" || tracks[1] != "goroutine 7 (2)" || tracks[2] != "(unnamed)" {
+		t.Errorf("unexpected tracks: %v", tracks)
+	}
+	if len(slices) != 3 {
+		t.Fatalf("expected 3 slices, got %d: %+v", len(slices), slices)
+	}
+	if slices[0].Name != "hold a" || slices[0].Ts != "1700000000123456.789" || slices[0].Args["goroutine"] != float64(7) {
+		t.Errorf("unexpected hold slice: %+v", slices[0])
+	}
+	if slices[1].Name != "wait b" || slices[1].Tid != 1 || slices[1].Ts != "1700000000123456.790" {
+		t.Errorf("unexpected wait slice: %+v", slices[1])
+	}
+	if slices[2].Name != "wait" || slices[2].Tid != 2 {
+		t.Errorf("unexpected slice for the lock without a goroutine: %+v", slices[2])
+	}
+}
@@ -0,0 +1,100 @@
+package analyze
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/stevenctl/deadlog"
+)
+
+// Collect accepts connections from deadlog.NetworkSink clients on l and
+// calls handle with every event they send, and every error reading from
+// them such as a *LineError, one call at a time. Traces are resolved per
+// connection as by ResolveTraces; NetworkSink sends its definitions again
+// on each connection. Events are tagged with the client they came from,
+// unless they already carry a source: "hostname/pid" from the HEADER that
+// NetworkSink sends on every connection, so reconnects of a process keep
+// one source and its outstanding operations still pair up, or else the
+// remote address of clients without one.
+//
+// Events are handled in the order they arrive. Each client's events are in
+// order, but events of different clients are only roughly ordered by Ts,
+// which is all a Tracker needs; sort by Ts before comparing clients on a
+// timeline. Collect returns when l is closed, after closing the remaining
+// connections; handle isn't called after it returns.
+func Collect(l net.Listener, handle func(deadlog.Event, error)) error {
+	var (
+		mu      sync.Mutex // serializes handle and guards conns
+		conns   = make(map[net.Conn]struct{})
+		wg      sync.WaitGroup
+		clients int
+		closed  bool
+	)
+	defer func() {
+		mu.Lock()
+		closed = true
+		for conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		mu.Lock()
+		clients++
+		conns[conn] = struct{}{}
+		fallback := fmt.Sprintf("client-%d", clients)
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				delete(conns, conn)
+				mu.Unlock()
+				conn.Close()
+			}()
+
+			source := ""
+			if addr := conn.RemoteAddr(); addr != nil && addr.String() != "" && addr.String() != "@" {
+				fallback = addr.String()
+			}
+			for e, err := range ResolveTraces(Events(conn)) {
+				if source == "" {
+					source = clientSource(e, fallback)
+				}
+				var lineErr *LineError
+				if errors.As(err, &lineErr) && lineErr.Source == "" {
+					lineErr.Source = source
+				}
+				if err == nil && e.Source == "" {
+					e.Source = source
+				}
+				mu.Lock()
+				if !closed {
+					handle(e, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+}
+
+// clientSource returns the source of a client given the first event it sent.
+func clientSource(first deadlog.Event, fallback string) string {
+	if first.Type == "HEADER" && first.Header != nil {
+		return fmt.Sprintf("%s/%d", first.Header.Hostname, first.Header.PID)
+	}
+	return fallback
+}
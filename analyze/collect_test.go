@@ -0,0 +1,189 @@
+package analyze
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stevenctl/deadlog"
+)
+
+func TestCollect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu       sync.Mutex
+		tracker  = NewTracker()
+		received = make(chan struct{}, 100)
+		lineErrs []*LineError
+	)
+	done := make(chan error)
+	go func() {
+		done <- Collect(l, func(e deadlog.Event, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if lineErr, ok := err.(*LineError); ok {
+				lineErrs = append(lineErrs, lineErr)
+			} else if err == nil {
+				tracker.Observe(e)
+			}
+			received <- struct{}{}
+		})
+	}()
+
+	// Two processes hold the same lock ID; a third client sends no header.
+	clients := []string{
+		`{"type":"HEADER","ts":1,"header":{"schema":1,"pid":10,"hostname":"a","go_version":"go","start":1}}
+{"type":"LOCK","state":"START","name":"cache","id":1,"ts":2}
+{"type":"LOCK","state":"ACQUIRED","name":"cache","id":1,"ts":3}
+`,
+		`{"type":"HEADER","ts":1,"header":{"schema":1,"pid":20,"hostname":"b","go_version":"go","start":1}}
+{"type":"LOCK","state":"START","name":"cache","id":1,"ts":2}
+{"type":"LOCK","state":"ACQUIRED","name":"cache",
+`,
+		`{"type":"LOCK","state":"START","name":"cache","id":1,"ts":2,"source":"custom"}
+`,
+	}
+	want := 3 + 3 + 1
+	for _, data := range clients {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+	for range want {
+		select {
+		case <-received:
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for events")
+		}
+	}
+	l.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+
+	result := tracker.Result()
+	var got []string
+	for _, info := range result.Held {
+		got = append(got, info.Source)
+	}
+	for _, info := range result.Stuck {
+		got = append(got, info.Source)
+	}
+	if fmt.Sprint(got) != "[a/10 b/20 custom]" {
+		t.Errorf("expected findings tagged by client, got %v", got)
+	}
+	if len(result.Sessions) != 2 {
+		t.Errorf("expected a session per client header, got %+v", result.Sessions)
+	}
+	if len(lineErrs) != 1 || lineErrs[0].Source != "b/20" || lineErrs[0].Line != 3 {
+		t.Errorf("expected line 3 of b/20 to be malformed, got %v", lineErrs)
+	}
+}
+
+func TestCollect_NewNetworkSink(t *testing.T) {
+	l, err := net.Listen("unix", t.TempDir()+"/collect.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan deadlog.Event, 10)
+	done := make(chan error)
+	go func() {
+		done <- Collect(l, func(e deadlog.Event, err error) {
+			if err == nil {
+				events <- e
+			}
+		})
+	}()
+
+	s := deadlog.NewNetworkSink("unix", l.Addr().String())
+	mu := deadlog.New(deadlog.WithName("cache"), deadlog.WithLogger(s.Log))
+	mu.Lock()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := deadlog.NewHeader(nil)
+	source := fmt.Sprintf("%s/%d", h.Hostname, h.PID)
+	for _, state := range []string{"", "START", "ACQUIRED"} {
+		select {
+		case e := <-events:
+			if e.State != state || e.Source != source {
+				t.Errorf("expected %q event from %s, got %+v", state, source, e)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for %q event", state)
+		}
+	}
+	l.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+}
+
+func TestCollect_Reconnect(t *testing.T) {
+	l, err := net.Listen("unix", t.TempDir()+"/collect.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := NewTracker()
+	observed := make(chan struct{}, 10)
+	done := make(chan error)
+	go func() {
+		done <- Collect(l, func(e deadlog.Event, err error) {
+			if err == nil {
+				tracker.Observe(e)
+				observed <- struct{}{}
+			}
+		})
+	}()
+	wait := func(n int) {
+		t.Helper()
+		for range n {
+			select {
+			case <-observed:
+			case <-time.After(10 * time.Second):
+				t.Fatal("timed out waiting for events")
+			}
+		}
+	}
+
+	// An operation that starts on one connection of a process and completes
+	// on the next pairs up, since both carry the process's header.
+	first := deadlog.NewNetworkSink("unix", l.Addr().String())
+	first.Log(deadlog.Event{Type: "LOCK", State: "START", Name: "cache", ID: 1, Ts: 1})
+	first.Close()
+	wait(2)
+	if r := tracker.Result(); len(r.Stuck) != 1 {
+		t.Fatalf("expected the START to be stuck, got %+v", r.Stuck)
+	}
+
+	second := deadlog.NewNetworkSink("unix", l.Addr().String())
+	second.Log(deadlog.Event{Type: "LOCK", State: "ACQUIRED", Name: "cache", ID: 1, Ts: 2})
+	second.Log(deadlog.Event{Type: "LOCK", State: "RELEASED", Name: "cache", ID: 1, Ts: 3})
+	second.Close()
+	wait(3)
+	r := tracker.Result()
+	if len(r.Stuck) != 0 || len(r.Held) != 0 {
+		t.Errorf("expected the operation to pair up across connections, got stuck %+v, held %+v", r.Stuck, r.Held)
+	}
+	if len(r.Sessions) != 1 {
+		t.Errorf("expected one session, got %+v", r.Sessions)
+	}
+
+	l.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+}
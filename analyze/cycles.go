@@ -0,0 +1,124 @@
+package analyze
+
+import (
+	"maps"
+	"slices"
+)
+
+// LockOrder is an observation of one lock being taken while another was
+// held by the same goroutine.
+type LockOrder struct {
+	Held   LockInfo // the tracked operation holding the first lock
+	Wanted LockInfo // the START of the second lock
+}
+
+// Cycle is a set of lock names acquired in inconsistent order: each lock
+// was taken while holding the previous one, and the first while holding the
+// last. Goroutines running these paths concurrently can deadlock, even if
+// the log shows no hang. Cycles are found by name, within a process, and
+// only from operations logged WithGoroutineID while a tracked lock was held.
+type Cycle struct {
+	Source  string
+	Package string      // package of the test binary, for go test -json input
+	Edges   []LockOrder // Edges[i].Wanted.Name is Edges[i+1].Held.Name
+}
+
+// Names returns the locks of the cycle in order, starting and ending with
+// the same name.
+func (c Cycle) Names() []string {
+	names := make([]string, 0, len(c.Edges)+1)
+	for _, e := range c.Edges {
+		names = append(names, e.Held.Name)
+	}
+	if len(c.Edges) > 0 {
+		names = append(names, c.Edges[0].Held.Name)
+	}
+	return names
+}
+
+// orderKey identifies an edge of the lock order graph of a process.
+type orderKey struct {
+	process
+	From, To string
+}
+
+// observeOrder records the locks held by the goroutine of a START as
+// ordered before it. t.mu must be held.
+func (t *Tracker) observeOrder(wanted LockInfo) {
+	if wanted.Goroutine == 0 || wanted.Name == "" {
+		return
+	}
+	for _, held := range t.acquires {
+		p := process{wanted.Source, wanted.Package}
+		if held.Source != p.source || held.Package != p.pkg || held.Goroutine != wanted.Goroutine || held.Name == wanted.Name {
+			continue
+		}
+		key := orderKey{process: p, From: held.Name, To: wanted.Name}
+		if _, ok := t.order[key]; !ok {
+			t.order[key] = LockOrder{Held: held, Wanted: wanted}
+		}
+	}
+}
+
+// cycles returns one cycle through each lock name of the lock order graph
+// that is the smallest name of a cycle, using the shortest such cycle.
+// t.mu must be held.
+func (t *Tracker) cycles() []Cycle {
+	graph := make(map[process]map[string][]string) // process -> from -> to
+	for key := range t.order {
+		if graph[key.process] == nil {
+			graph[key.process] = make(map[string][]string)
+		}
+		graph[key.process][key.From] = append(graph[key.process][key.From], key.To)
+	}
+
+	var out []Cycle
+	for _, p := range slices.SortedFunc(maps.Keys(graph), compareProcesses) {
+		edges := graph[p]
+		for _, to := range edges {
+			slices.Sort(to)
+		}
+		for _, start := range slices.Sorted(maps.Keys(edges)) {
+			path := shortestCycle(edges, start)
+			if path == nil {
+				continue
+			}
+			c := Cycle{Source: p.source, Package: p.pkg}
+			for i, from := range path {
+				to := path[(i+1)%len(path)]
+				c.Edges = append(c.Edges, t.order[orderKey{process: p, From: from, To: to}])
+			}
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// shortestCycle returns the names of the shortest cycle from start back to
+// itself that only visits names greater than start, so that every cycle is
+// found once, from its smallest name. It returns nil if there is none.
+func shortestCycle(edges map[string][]string, start string) []string {
+	prev := map[string]string{}
+	queue := []string{start}
+	for len(queue) > 0 {
+		from := queue[0]
+		queue = queue[1:]
+		for _, to := range edges[from] {
+			if to == start {
+				path := []string{from}
+				for n := from; n != start; {
+					n = prev[n]
+					path = append(path, n)
+				}
+				slices.Reverse(path)
+				return path
+			}
+			if _, seen := prev[to]; seen || to < start {
+				continue
+			}
+			prev[to] = from
+			queue = append(queue, to)
+		}
+	}
+	return nil
+}
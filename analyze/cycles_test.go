@@ -0,0 +1,88 @@
+package analyze
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stevenctl/deadlog"
+)
+
+func TestTracker_Cycles(t *testing.T) {
+	tracker := NewTracker()
+	opts := []deadlog.Option{deadlog.WithLogger(tracker.Observe), deadlog.WithGoroutineID()}
+	a := deadlog.New(append(opts, deadlog.WithName("a"))...)
+	b := deadlog.New(append(opts, deadlog.WithName("b"))...)
+	c := deadlog.New(append(opts, deadlog.WithName("c"))...)
+
+	// a -> b and b -> a, run one after the other so nothing hangs; c is only
+	// ever taken after a.
+	unlockA := a.LockFunc()
+	unlockB := b.LockFunc()
+	unlockB()
+	unlockA()
+
+	unlockB = b.LockFunc()
+	unlockA = a.LockFunc()
+	unlockC := c.LockFunc()
+	unlockC()
+	unlockA()
+	unlockB()
+
+	result := tracker.Result()
+	if len(result.Cycles) != 1 {
+		t.Fatalf("expected 1 cycle, got %+v", result.Cycles)
+	}
+	if got := strings.Join(result.Cycles[0].Names(), " -> "); got != "a -> b -> a" {
+		t.Errorf("expected a -> b -> a, got %s", got)
+	}
+	for _, e := range result.Cycles[0].Edges {
+		if e.Wanted.Goroutine == 0 || e.Wanted.Goroutine != e.Held.Goroutine {
+			t.Errorf("expected both ends of %s -> %s on one goroutine, got %d and %d", e.Held.Name, e.Wanted.Name, e.Held.Goroutine, e.Wanted.Goroutine)
+		}
+	}
+
+	var buf bytes.Buffer
+	PrintReport(&buf, result)
+	if !strings.Contains(buf.String(), "=== CYCLES") || !strings.Contains(buf.String(), "b taken while holding a") {
+		t.Errorf("expected the cycle in the report, got:\n%s", buf.String())
+	}
+}
+
+func TestTracker_CyclesNeedGoroutineIDs(t *testing.T) {
+	tracker := NewTracker()
+	a := deadlog.New(deadlog.WithName("a"), deadlog.WithLogger(tracker.Observe))
+	b := deadlog.New(deadlog.WithName("b"), deadlog.WithLogger(tracker.Observe))
+
+	unlockA := a.LockFunc()
+	unlockB := b.LockFunc()
+	unlockB()
+	unlockA()
+	unlockB = b.LockFunc()
+	unlockA = a.LockFunc()
+	unlockA()
+	unlockB()
+
+	if cycles := tracker.Result().Cycles; len(cycles) != 0 {
+		t.Errorf("expected no cycles without goroutine IDs, got %+v", cycles)
+	}
+}
+
+func TestShortestCycle(t *testing.T) {
+	edges := map[string][]string{
+		"a": {"b", "c"},
+		"b": {"c"},
+		"c": {"a"},
+		"d": {"a"},
+	}
+	if got := shortestCycle(edges, "a"); strings.Join(got, ",") != "a,c" {
+		t.Errorf("expected a,c, got %v", got)
+	}
+	// Cycles through a are found from a only.
+	if got := shortestCycle(edges, "b"); got != nil {
+		t.Errorf("expected no cycle from b, got %v", got)
+	}
+	if got := shortestCycle(edges, "d"); got != nil {
+		t.Errorf("expected no cycle from d, got %v", got)
+	}
+}
@@ -0,0 +1,386 @@
+package analyze
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/stevenctl/deadlog"
+)
+
+// maxLineSize bounds the length of a single log line. Events with deep
+// structured frames can be much longer than bufio's default 64KB.
+const maxLineSize = 16 << 20
+
+// LineError reports a line that looks like a JSON event but can't be decoded.
+type LineError struct {
+	Source string // file the line is in, if known, see WithSource
+	Line   int    // 1-based line number
+	Err    error  // the decoding error
+}
+
+func (e *LineError) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("%s: line %d: %v", e.Source, e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Events returns an iterator over the deadlog events in r, one per line.
+// Events may be embedded in other log output, after a prefix added by
+// log.Printf, klog, docker logs --timestamps, kubectl logs --prefix or go test
+// -v, and may be a quoted JSON string as written by structured loggers; the
+// text before the event is kept in Event.Prefix. go test -json output is
+// unwrapped, with Event.Package and Event.Test set to the test that logged
+// each event; output that a test leaves without a final newline is decoded
+// when the test ends or the input does. Lines without an event are skipped,
+// as are JSON objects without a type. Lines that start like a JSON object,
+// or contain a "type" key, but fail to decode yield a *LineError and
+// iteration continues; read errors end the iteration.
+func Events(r io.Reader) iter.Seq2[deadlog.Event, error] {
+	return func(yield func(deadlog.Event, error) bool) {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+		// Output of each test that hasn't ended in a newline yet.
+		partial := make(map[testKey][]byte)
+		lineNo := 0
+
+		// emit decodes a line of test's output, or of r if test is zero, and
+		// reports whether to continue.
+		emit := func(line []byte, test testKey) bool {
+			e, ok, err := decodeLine(line)
+			if err != nil {
+				return yield(deadlog.Event{}, &LineError{Line: lineNo, Err: err})
+			}
+			if !ok {
+				return true
+			}
+			e.Package, e.Test = test.pkg, test.test
+			return yield(e, nil)
+		}
+		// flush emits the output of test that never ended in a newline.
+		flush := func(test testKey) bool {
+			out, ok := partial[test]
+			if !ok {
+				return true
+			}
+			delete(partial, test)
+			return emit(bytes.TrimSpace(out), test)
+		}
+
+		for scanner.Scan() {
+			lineNo++
+			line := bytes.TrimSpace(scanner.Bytes())
+
+			var test testKey
+			if rec, ok := decodeTestEvent(line); ok {
+				test = testKey{rec.Package, rec.Test}
+				if rec.Action != "output" {
+					// A test that ended, such as by a panic, won't
+					// finish its last line.
+					if !flush(test) {
+						return
+					}
+					continue
+				}
+				out := append(partial[test], rec.Output...)
+				if !bytes.HasSuffix(out, []byte("\n")) {
+					// test2json splits long lines across records.
+					partial[test] = out
+					continue
+				}
+				delete(partial, test)
+				line = bytes.TrimSpace(out)
+			}
+			if !emit(line, test) {
+				return
+			}
+		}
+		for _, test := range slices.SortedFunc(maps.Keys(partial), compareTestKeys) {
+			if !flush(test) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(deadlog.Event{}, err)
+		}
+	}
+}
+
+// testEvent is a record of go test -json output, see go doc test2json.
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+}
+
+type testKey struct {
+	pkg, test string
+}
+
+func compareTestKeys(a, b testKey) int {
+	return cmp.Or(strings.Compare(a.pkg, b.pkg), strings.Compare(a.test, b.test))
+}
+
+// decodeTestEvent decodes a line of go test -json output.
+func decodeTestEvent(line []byte) (testEvent, bool) {
+	var rec testEvent
+	if !bytes.HasPrefix(line, []byte(`{"Time":`)) && !bytes.HasPrefix(line, []byte(`{"Action":`)) {
+		return rec, false
+	}
+	if err := json.Unmarshal(line, &rec); err != nil || rec.Action == "" {
+		return rec, false
+	}
+	return rec, true
+}
+
+// decodeLine finds the deadlog event in a line. It reports whether an event
+// was found, or an error if the line holds one that can't be decoded.
+func decodeLine(line []byte) (deadlog.Event, bool, error) {
+	var e deadlog.Event
+	jsonLine := len(line) > 0 && line[0] == '{'
+	if jsonLine {
+		if err := json.Unmarshal(line, &e); err != nil {
+			return e, false, err
+		}
+		if e.Type != "" {
+			return e, true, nil
+		}
+		// Some other JSON log line, which may carry an event as a string.
+	}
+
+	// Events are encoded with their type first, so only candidates starting
+	// with it are decoded, which keeps long lines full of other JSON linear.
+	for i := 0; i < len(line)-1; i++ {
+		var data []byte
+		switch {
+		case line[i] == '{' && !jsonLine && bytes.HasPrefix(line[i:], eventStart):
+			data = line[i:]
+		case line[i] == '"' && bytes.HasPrefix(line[i+1:], quotedEventStart):
+			// A quoted event, e.g. klog's event="{\"type\":...}".
+			var s string
+			if err := json.NewDecoder(bytes.NewReader(line[i:])).Decode(&s); err != nil {
+				return deadlog.Event{}, false, err
+			}
+			data = []byte(s)
+		default:
+			continue
+		}
+
+		// Decode the first value only, allowing trailing text. Embedded
+		// objects must also have a timestamp, so that other JSON with a
+		// "type" key isn't mistaken for an event.
+		e = deadlog.Event{}
+		if err := json.NewDecoder(bytes.NewReader(data)).Decode(&e); err != nil {
+			return deadlog.Event{}, false, err
+		}
+		if e.Type != "" && e.Ts != 0 {
+			e.Prefix = string(bytes.TrimSpace(line[:i]))
+			return e, true, nil
+		}
+	}
+	return deadlog.Event{}, false, nil
+}
+
+// eventStart is how an encoded deadlog.Event begins, and quotedEventStart
+// how it begins inside a JSON string.
+var (
+	eventStart       = []byte(`{"type":`)
+	quotedEventStart = []byte(`{\"type\":`)
+)
+
+// Filter returns an iterator over the events for which keep returns true.
+// Errors are passed through.
+func Filter(events iter.Seq2[deadlog.Event, error], keep func(deadlog.Event) bool) iter.Seq2[deadlog.Event, error] {
+	return func(yield func(deadlog.Event, error) bool) {
+		for e, err := range events {
+			if err == nil && !keep(e) {
+				continue
+			}
+			if !yield(e, err) {
+				return
+			}
+		}
+	}
+}
+
+// Map returns an iterator over the events transformed by fn.
+// Errors are passed through.
+func Map(events iter.Seq2[deadlog.Event, error], fn func(deadlog.Event) deadlog.Event) iter.Seq2[deadlog.Event, error] {
+	return func(yield func(deadlog.Event, error) bool) {
+		for e, err := range events {
+			if err == nil {
+				e = fn(e)
+			}
+			if !yield(e, err) {
+				return
+			}
+		}
+	}
+}
+
+// ResolveTraces returns an iterator that fills in the stack of events logged
+// by deadlog.InternTraces from their TRACE definitions. The TRACE events
+// themselves are consumed, so apply it before filters that would drop them.
+// Events whose definition hasn't been seen keep only their TraceID.
+//
+// Trace IDs are only unique within a process, so definitions are kept per
+// Source and, for go test -json input, per Package, and forgotten when a
+// HEADER shows that a different process took over, such as after a restart
+// appending to the same log.
+func ResolveTraces(events iter.Seq2[deadlog.Event, error]) iter.Seq2[deadlog.Event, error] {
+	type traceKey struct {
+		process
+		id int
+	}
+	return func(yield func(deadlog.Event, error) bool) {
+		traces := make(map[traceKey]deadlog.Event)
+		headers := make(map[process]*deadlog.Header)
+		for e, err := range events {
+			if err == nil {
+				p := processOf(e)
+				switch {
+				case e.Type == "HEADER" && e.Header != nil:
+					if h, ok := headers[p]; ok && !h.SameProcess(e.Header) {
+						for key := range traces {
+							if key.process == p {
+								delete(traces, key)
+							}
+						}
+					}
+					headers[p] = e.Header
+				case e.Type == "TRACE":
+					traces[traceKey{p, e.TraceID}] = e
+					continue
+				}
+				if def, ok := traces[traceKey{p, e.TraceID}]; ok && e.TraceID != 0 {
+					e.Trace = def.Trace
+					e.Frames = def.Frames
+					e.PCs = def.PCs
+					e.BuildID = def.BuildID
+				}
+			}
+			if !yield(e, err) {
+				return
+			}
+		}
+	}
+}
+
+// WithSource returns an iterator that sets the Source of events that don't
+// have one, and of line errors, to source. Use it to label each log before
+// merging several with Merge.
+func WithSource(source string, events iter.Seq2[deadlog.Event, error]) iter.Seq2[deadlog.Event, error] {
+	return func(yield func(deadlog.Event, error) bool) {
+		for e, err := range events {
+			var lineErr *LineError
+			if errors.As(err, &lineErr) && lineErr.Source == "" {
+				lineErr.Source = source
+			}
+			if err == nil && e.Source == "" {
+				e.Source = source
+			}
+			if !yield(e, err) {
+				return
+			}
+		}
+	}
+}
+
+// Merge returns an iterator that interleaves several event streams by
+// timestamp, such as the logs of several processes. Each stream should be in
+// timestamp order; their events are labelled with WithSource and their
+// traces resolved with ResolveTraces beforehand, since IDs and interned
+// traces are only unique within a process. Errors are passed through as they
+// are read.
+func Merge(streams ...iter.Seq2[deadlog.Event, error]) iter.Seq2[deadlog.Event, error] {
+	return func(yield func(deadlog.Event, error) bool) {
+		type head struct {
+			next func() (deadlog.Event, error, bool)
+			e    deadlog.Event
+			ok   bool
+		}
+		heads := make([]*head, len(streams))
+		for i, s := range streams {
+			next, stop := iter.Pull2(s)
+			defer stop()
+			heads[i] = &head{next: next}
+		}
+
+		// advance reads the next event of h, yielding any errors on the way.
+		advance := func(h *head) bool {
+			for {
+				e, err, ok := h.next()
+				if !ok {
+					h.ok = false
+					return true
+				}
+				if err != nil {
+					if !yield(deadlog.Event{}, err) {
+						return false
+					}
+					continue
+				}
+				h.e, h.ok = e, true
+				return true
+			}
+		}
+		for _, h := range heads {
+			if !advance(h) {
+				return
+			}
+		}
+
+		for {
+			var first *head
+			for _, h := range heads {
+				if h.ok && (first == nil || h.e.Ts < first.e.Ts) {
+					first = h
+				}
+			}
+			if first == nil {
+				return
+			}
+			if !yield(first.e, nil) || !advance(first) {
+				return
+			}
+		}
+	}
+}
+
+// ByName returns a Filter predicate that keeps events with one of the names.
+func ByName(names ...string) func(deadlog.Event) bool {
+	set := make(map[string]struct{}, len(names))
+	for _, n := range names {
+		set[n] = struct{}{}
+	}
+	return func(e deadlog.Event) bool {
+		_, ok := set[e.Name]
+		return ok
+	}
+}
+
+// ByType returns a Filter predicate that keeps events with one of the types.
+func ByType(types ...string) func(deadlog.Event) bool {
+	set := make(map[string]struct{}, len(types))
+	for _, t := range types {
+		set[t] = struct{}{}
+	}
+	return func(e deadlog.Event) bool {
+		_, ok := set[e.Type]
+		return ok
+	}
+}
@@ -0,0 +1,409 @@
+package analyze
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stevenctl/deadlog"
+)
+
+func TestEvents(t *testing.T) {
+	input := `starting app
+{"type":"LOCK","state":"START","name":"a","id":1,"ts":1}
+{"level":"info","msg":"some other JSON log"}
+{"type":"LOCK","state":"ACQUIRED","name":"a","id":1,"ts":2
+  {"type":"LOCK","state":"ACQUIRED","name":"a","id":1,"ts":3}
+`
+	var events []deadlog.Event
+	var lineErrs []*LineError
+	for e, err := range Events(strings.NewReader(input)) {
+		if err != nil {
+			var lineErr *LineError
+			if !errors.As(err, &lineErr) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			lineErrs = append(lineErrs, lineErr)
+			continue
+		}
+		events = append(events, e)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].State != "START" || events[1].State != "ACQUIRED" {
+		t.Errorf("unexpected events: %+v", events)
+	}
+	if len(lineErrs) != 1 || lineErrs[0].Line != 4 {
+		t.Errorf("expected a malformed line 4, got %v", lineErrs)
+	}
+}
+
+func TestEvents_LongLine(t *testing.T) {
+	trace := strings.Repeat("frame:1 <- ", 20000) + "main:1"
+	input := `{"type":"LOCK","state":"START","name":"a","id":1,"trace":"` + trace + `","ts":1}` + "\n"
+
+	var events []deadlog.Event
+	for e, err := range Events(strings.NewReader(input)) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 1 || events[0].Trace != trace {
+		t.Errorf("expected one event with a %d byte trace", len(trace))
+	}
+}
+
+func TestEvents_LongPrefixedLine(t *testing.T) {
+	// Each {" could start an event; decoding from every one of them would
+	// take quadratic time.
+	prefix := strings.Repeat(`{"k":`, 50000)
+	input := "log " + prefix + ` {"type":"LOCK","state":"START","name":"a","id":1,"ts":1}` + "\n"
+
+	start := time.Now()
+	var events []deadlog.Event
+	for e, err := range Events(strings.NewReader(input)) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 1 || events[0].ID != 1 {
+		t.Errorf("expected the event after the prefix, got %+v", events)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("decoding a %d byte line took %s", len(input), d)
+	}
+}
+
+func TestEvents_Break(t *testing.T) {
+	input := `{"type":"LOCK","state":"START","name":"a","id":1,"ts":1}
+{"type":"LOCK","state":"START","name":"b","id":2,"ts":2}
+`
+	n := 0
+	for range Events(strings.NewReader(input)) {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("expected iteration to stop after 1 event, got %d", n)
+	}
+}
+
+func TestFilterMap(t *testing.T) {
+	input := `{"type":"LOCK","state":"START","name":"a","id":1,"ts":1}
+{"type":"WLOCK","state":"START","name":"b","id":2,"ts":2}
+{"type":"LOCK","state":"START","name":"c","id":3,"ts":3}
+`
+	events := Filter(Events(strings.NewReader(input)), ByType("LOCK"))
+	events = Filter(events, ByName("a", "b"))
+	events = Map(events, func(e deadlog.Event) deadlog.Event {
+		e.Name = strings.ToUpper(e.Name)
+		return e
+	})
+
+	var names []string
+	for e, err := range events {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		names = append(names, e.Name)
+	}
+	if len(names) != 1 || names[0] != "A" {
+		t.Errorf("expected [A], got %v", names)
+	}
+}
+
+func TestResolveTraces(t *testing.T) {
+	input := `{"type":"TRACE","trace":"main:10","trace_id":1,"ts":1}
+{"type":"LOCK","state":"START","name":"a","id":1,"trace_id":1,"ts":2}
+{"type":"LOCK","state":"ACQUIRED","name":"a","id":1,"trace_id":2,"ts":3}
+`
+	var events []deadlog.Event
+	for e, err := range ResolveTraces(Events(strings.NewReader(input))) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected TRACE definitions to be consumed, got %d events", len(events))
+	}
+	if events[0].Trace != "main:10" {
+		t.Errorf("expected resolved trace, got %q", events[0].Trace)
+	}
+	if events[1].Trace != "" || events[1].TraceID != 2 {
+		t.Errorf("expected unresolved trace ID to be kept, got %+v", events[1])
+	}
+}
+
+func TestResolveTraces_Processes(t *testing.T) {
+	input := `{"type":"HEADER","header":{"pid":1,"start":1},"ts":1}
+{"type":"TRACE","trace":"a:1","trace_id":1,"ts":1}
+{"type":"LOCK","state":"START","name":"a","id":1,"trace_id":1,"ts":2}
+{"type":"HEADER","header":{"pid":1,"start":1},"ts":3}
+{"type":"LOCK","state":"START","name":"a","id":2,"trace_id":1,"ts":4}
+{"type":"HEADER","header":{"pid":2,"start":5},"ts":5}
+{"type":"LOCK","state":"START","name":"a","id":3,"trace_id":1,"ts":6}
+{"Action":"output","Package":"p","Test":"T","Output":"{\"type\":\"TRACE\",\"trace\":\"p:1\",\"trace_id\":1,\"ts\":7}\n"}
+{"Action":"output","Package":"q","Test":"T","Output":"{\"type\":\"TRACE\",\"trace\":\"q:1\",\"trace_id\":1,\"ts\":7}\n"}
+{"Action":"output","Package":"p","Test":"T","Output":"{\"type\":\"LOCK\",\"state\":\"START\",\"name\":\"p\",\"id\":4,\"trace_id\":1,\"ts\":8}\n"}
+{"Action":"output","Package":"q","Test":"T","Output":"{\"type\":\"LOCK\",\"state\":\"START\",\"name\":\"q\",\"id\":5,\"trace_id\":1,\"ts\":8}\n"}
+`
+	traces := make(map[int]string)
+	for e, err := range ResolveTraces(Events(strings.NewReader(input))) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if e.State == "START" {
+			traces[e.ID] = e.Trace
+		}
+	}
+	// The same process's header keeps its definitions, a restart drops
+	// them, and each test package has its own.
+	want := map[int]string{1: "a:1", 2: "a:1", 3: "", 4: "p:1", 5: "q:1"}
+	for id, trace := range want {
+		if traces[id] != trace {
+			t.Errorf("ID %d: expected trace %q, got %q", id, trace, traces[id])
+		}
+	}
+}
+
+func TestEvents_Prefixed(t *testing.T) {
+	// Each file in the corpus logs the same three events in a different
+	// real-world format: ID 1 is held and ID 2 is stuck.
+	tests := []struct {
+		file   string
+		prefix string // prefix of the stuck event
+	}{
+		{"plain.log", ""},
+		{"log-printf.log", "2024/01/01 00:00:00"},
+		{"log-printf-lshortfile.log", "2024/01/01 00:00:00.002003 main.go:58:"},
+		{"klog.log", "I0101 00:00:00.002003   12346 locks.go:17]"},
+		{"klog-structured.log", `I0101 00:00:00.002003   12346 locks.go:17] "deadlog" event=`},
+		{"slog-json.log", `{"time":"2024-01-01T00:00:00.002003Z","level":"INFO","msg":"deadlog","event":`},
+		{"docker-timestamps.log", "2024-01-01T00:00:00.002003000Z"},
+		{"kubectl-prefix.log", "[pod/game-7d9f8b-x2k4q/server]"},
+		{"go-test-v.log", "game_test.go:44:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			result, err := AnalyzeFile(filepath.Join("testdata", "prefixed", tt.file))
+			if err != nil {
+				t.Fatalf("AnalyzeFile error: %v", err)
+			}
+			if len(result.Malformed) != 0 {
+				t.Errorf("expected no malformed lines, got %v", result.Malformed)
+			}
+			if len(result.Held) != 1 || result.Held[0].ID != 1 {
+				t.Errorf("expected ID 1 to be held, got %+v", result.Held)
+			}
+			if len(result.Stuck) != 1 || result.Stuck[0].ID != 2 {
+				t.Fatalf("expected ID 2 to be stuck, got %+v", result.Stuck)
+			}
+			if got := result.Stuck[0].Prefix; got != tt.prefix {
+				t.Errorf("expected prefix %q, got %q", tt.prefix, got)
+			}
+			if result.Stuck[0].Trace != "applyDamage:33" {
+				t.Errorf("unexpected trace %q", result.Stuck[0].Trace)
+			}
+		})
+	}
+}
+
+func TestEvents_PrefixedMalformed(t *testing.T) {
+	input := `2024/01/01 00:00:00 {"type":"LOCK","state":"START","name":"a","id":1,
+2024/01/01 00:00:00 handled {"path":"/health"}
+2024/01/01 00:00:00 config {"type":"file","path":"/etc/app"}
+2024/01/01 00:00:00 {"type":"LOCK","state":"START","name":"a","id":2,"ts":5} trailing text
+`
+	var events []deadlog.Event
+	var lines []int
+	for e, err := range Events(strings.NewReader(input)) {
+		var lineErr *LineError
+		if errors.As(err, &lineErr) {
+			lines = append(lines, lineErr.Line)
+			continue
+		}
+		events = append(events, e)
+	}
+	if len(lines) != 1 || lines[0] != 1 {
+		t.Errorf("expected a malformed line 1, got %v", lines)
+	}
+	if len(events) != 1 || events[0].ID != 2 || events[0].Prefix != "2024/01/01 00:00:00" {
+		t.Errorf("expected only the event with ID 2, got %+v", events)
+	}
+}
+
+func TestEvents_GoTestJSON(t *testing.T) {
+	// Generated with go test -json: TestDamage leaks a LockFunc and
+	// TestLogged leaks an RLockFunc logged through t.Logf.
+	result, err := AnalyzeFile(filepath.Join("testdata", "go-test.json"))
+	if err != nil {
+		t.Fatalf("AnalyzeFile error: %v", err)
+	}
+	if len(result.Stuck) != 0 {
+		t.Errorf("expected no stuck locks, got %+v", result.Stuck)
+	}
+	if len(result.Held) != 2 {
+		t.Fatalf("expected 2 held locks, got %+v", result.Held)
+	}
+	for _, info := range result.Held {
+		if info.Package != "example.com/game" {
+			t.Errorf("unexpected package %q", info.Package)
+		}
+	}
+	if info := result.Held[0]; info.Name != "player-state" || info.Test != "TestDamage" {
+		t.Errorf("expected player-state held by TestDamage, got %+v", info)
+	}
+	if info := result.Held[1]; info.Name != "inventory" || info.Test != "TestLogged" || info.Prefix != "game_test.go:24:" {
+		t.Errorf("expected inventory held by TestLogged, got %+v", info)
+	}
+
+	var buf bytes.Buffer
+	PrintReport(&buf, result)
+	if !strings.Contains(buf.String(), "Test: TestDamage (example.com/game)") {
+		t.Errorf("report should name the test:\n%s", buf.String())
+	}
+}
+
+func TestEvents_GoTestJSONSplitLines(t *testing.T) {
+	// test2json splits long lines across records, interleaved with other tests.
+	input := `{"Time":"2024-01-01T00:00:00Z","Action":"run","Package":"p","Test":"TestA"}
+{"Time":"2024-01-01T00:00:00Z","Action":"output","Package":"p","Test":"TestA","Output":"{\"type\":\"LOCK\",\"state\":\"START\","}
+{"Time":"2024-01-01T00:00:00Z","Action":"output","Package":"p","Test":"TestB","Output":"{\"type\":\"LOCK\",\"state\":\"START\",\"name\":\"b\",\"id\":2,\"ts\":1}\n"}
+{"Time":"2024-01-01T00:00:00Z","Action":"output","Package":"p","Test":"TestA","Output":"\"name\":\"a\",\"id\":1,\"ts\":1}\n"}
+{"Time":"2024-01-01T00:00:00Z","Action":"fail","Package":"p","Test":"TestA","Elapsed":1}
+`
+	var events []deadlog.Event
+	for e, err := range Events(strings.NewReader(input)) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+	if events[0].Name != "b" || events[0].Test != "TestB" {
+		t.Errorf("unexpected first event: %+v", events[0])
+	}
+	if events[1].Name != "a" || events[1].Test != "TestA" || events[1].Package != "p" {
+		t.Errorf("unexpected second event: %+v", events[1])
+	}
+}
+
+func TestEvents_GoTestJSONPartialLines(t *testing.T) {
+	// TestA panics before its line ends, and the output of TestB is cut off
+	// without a newline at the end of the input.
+	input := `{"Time":"2024-01-01T00:00:00Z","Action":"output","Package":"p","Test":"TestA","Output":"{\"type\":\"LOCK\",\"state\":\"START\",\"name\":\"a\",\"id\":1,\"ts\":1}"}
+{"Time":"2024-01-01T00:00:00Z","Action":"fail","Package":"p","Test":"TestA","Elapsed":1}
+{"Time":"2024-01-01T00:00:00Z","Action":"output","Package":"p","Test":"TestB","Output":"{\"type\":\"LOCK\",\"state\":\"START\",\"name\":\"b\",\"id\":2,\"ts\":2}"}
+`
+	var events []deadlog.Event
+	for e, err := range Events(strings.NewReader(input)) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+	if events[0].Name != "a" || events[0].Test != "TestA" {
+		t.Errorf("expected TestA's event when it ended, got %+v", events[0])
+	}
+	if events[1].Name != "b" || events[1].Test != "TestB" || events[1].Package != "p" {
+		t.Errorf("expected TestB's event at the end of the input, got %+v", events[1])
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := `{"type":"LOCK","state":"START","name":"cache","id":7,"ts":100}
+{"type":"LOCK","state":"ACQUIRED","name":"cache","id":7,"ts":300}
+{"type":"LOCK","state":"RELEASED","name":"cache","id":7,"ts":500}
+`
+	b := `{"type":"LOCK","state":"START","name":"cache","id":7,"ts":200}
+{"type":"LOCK","state":"ACQUIRED","name":"cache","id":7,
+{"type":"LOCK","state":"ACQUIRED","name":"cache","id":7,"ts":400}
+`
+	events := Merge(
+		WithSource("a.log", Events(strings.NewReader(a))),
+		WithSource("b.log", Events(strings.NewReader(b))),
+	)
+
+	var got []string
+	var lineErrs []*LineError
+	for e, err := range events {
+		if err != nil {
+			var lineErr *LineError
+			if !errors.As(err, &lineErr) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			lineErrs = append(lineErrs, lineErr)
+			continue
+		}
+		got = append(got, e.Source+" "+e.State)
+	}
+	want := []string{"a.log START", "b.log START", "a.log ACQUIRED", "b.log ACQUIRED", "a.log RELEASED"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if len(lineErrs) != 1 || lineErrs[0].Source != "b.log" || lineErrs[0].Line != 2 {
+		t.Errorf("expected a malformed line 2 in b.log, got %v", lineErrs)
+	}
+	if len(lineErrs) == 1 && !strings.HasPrefix(lineErrs[0].Error(), "b.log: line 2: ") {
+		t.Errorf("unexpected error message: %v", lineErrs[0])
+	}
+
+	// The same ID in two processes is two operations.
+	result, err := AnalyzeEvents(Merge(
+		WithSource("a.log", Events(strings.NewReader(a))),
+		WithSource("b.log", Events(strings.NewReader(b))),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Held) != 1 || result.Held[0].Source != "b.log" {
+		t.Errorf("expected ID 7 held in b.log, got %+v", result.Held)
+	}
+}
+
+func TestMerge_Break(t *testing.T) {
+	a := `{"type":"LOCK","state":"START","name":"a","id":1,"ts":1}
+{"type":"LOCK","state":"START","name":"a","id":2,"ts":3}
+`
+	b := `{"type":"LOCK","state":"START","name":"b","id":3,"ts":2}
+`
+	count := 0
+	for range Merge(Events(strings.NewReader(a)), Events(strings.NewReader(b))) {
+		count++
+		if count == 2 {
+			break
+		}
+	}
+	if count != 2 {
+		t.Errorf("expected to stop after 2 events, got %d", count)
+	}
+}
+
+func TestWithSource_KeepsExisting(t *testing.T) {
+	input := `{"type":"LOCK","state":"START","name":"a","id":1,"ts":1,"source":"replica-1"}
+{"type":"LOCK","state":"START","name":"a","id":2,"ts":2}
+`
+	var sources []string
+	for e, err := range WithSource("app.log", Events(strings.NewReader(input))) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, e.Source)
+	}
+	if len(sources) != 2 || sources[0] != "replica-1" || sources[1] != "app.log" {
+		t.Errorf("unexpected sources: %v", sources)
+	}
+}
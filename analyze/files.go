@@ -0,0 +1,238 @@
+package analyze
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"iter"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/stevenctl/deadlog"
+)
+
+// Decompress returns a reader of the decompressed contents of r if it is
+// gzip-compressed, and of r itself otherwise.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		// Too short to be gzip, or not gzip.
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
+
+// OpenLog opens a log file, decompressing it if it is gzip-compressed.
+func OpenLog(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
+
+var (
+	rotatedNumber = regexp.MustCompile(`^(.+)\.(\d+)$`)
+	rotatedDate   = regexp.MustCompile(`^(.+)-(\d{8,})$`)
+)
+
+// rotation describes where a file belongs in a rotated set.
+type rotation struct {
+	base string // the live file, e.g. "app.log"
+	gen  int    // numbered generation, higher is older; 0 for the live file
+	date string // date suffix, later is newer
+}
+
+// parseRotation parses names like app.log, app.log.1.gz and app.log-20240101.gz.
+func parseRotation(path string) rotation {
+	name := strings.TrimSuffix(path, ".gz")
+	if m := rotatedNumber.FindStringSubmatch(name); m != nil {
+		gen, _ := strconv.Atoi(m[2])
+		return rotation{base: m[1], gen: gen}
+	}
+	if m := rotatedDate.FindStringSubmatch(name); m != nil {
+		return rotation{base: m[1], date: m[2]}
+	}
+	return rotation{base: name}
+}
+
+// GroupRotated groups log files into rotated sets by their live file name,
+// in the order the sets first appear. Each set is sorted oldest first:
+// numbered generations from the highest, then dated ones from the earliest,
+// then the live file.
+//
+// A numeric or date suffix alone doesn't make a file a rotation, since logs
+// of replicas are often named like worker.1 and worker.2. A suffixed file
+// joins a set only if its live file is among paths, or if its HEADER shows
+// it was written by the same process as the set, as with files rotated by
+// deadlog.RotatingFile. Other files are sets of their own.
+func GroupRotated(paths []string) [][]string {
+	headers := make(map[string]*deadlog.Header)
+	header := func(path string) *deadlog.Header {
+		h, ok := headers[path]
+		if !ok {
+			h = FileHeader(path)
+			headers[path] = h
+		}
+		return h
+	}
+	return groupRotated(paths, func(a, b string) bool {
+		ha, hb := header(a), header(b)
+		return ha != nil && hb != nil && ha.SameProcess(hb)
+	})
+}
+
+// groupRotated is GroupRotated with a function that reports whether two
+// suffixed files without their live file belong to one set.
+func groupRotated(paths []string, same func(a, b string) bool) [][]string {
+	live := make(map[string]bool)
+	for _, p := range paths {
+		if r := parseRotation(p); r.gen == 0 && r.date == "" {
+			live[r.base] = true
+		}
+	}
+
+	var (
+		sets   [][]string
+		byBase = make(map[string][]int) // indexes of the sets of each base
+	)
+	for _, p := range paths {
+		base := parseRotation(p).base
+		i := -1
+		for _, j := range byBase[base] {
+			if slices.Contains(sets[j], p) || live[base] || same(sets[j][0], p) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			byBase[base] = append(byBase[base], len(sets))
+			sets = append(sets, nil)
+			i = len(sets) - 1
+		}
+		if !slices.Contains(sets[i], p) {
+			sets[i] = append(sets[i], p)
+		}
+	}
+
+	// age orders files oldest first.
+	age := func(r rotation) (int, int, string) {
+		switch {
+		case r.gen > 0:
+			return 0, -r.gen, ""
+		case r.date != "":
+			return 1, 0, r.date
+		default:
+			return 2, 0, ""
+		}
+	}
+	for _, set := range sets {
+		slices.SortStableFunc(set, func(a, b string) int {
+			ac, ag, ad := age(parseRotation(a))
+			bc, bg, bd := age(parseRotation(b))
+			if ac != bc {
+				return ac - bc
+			}
+			if ag != bg {
+				return ag - bg
+			}
+			return strings.Compare(ad, bd)
+		})
+	}
+	return sets
+}
+
+// FileHeader returns the header of a log file, such as a state dump, if its
+// first event is one, and nil otherwise.
+func FileHeader(path string) *deadlog.Header {
+	r, err := OpenLog(path)
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	for e, err := range Events(r) {
+		if err != nil {
+			continue
+		}
+		if e.Type == "HEADER" {
+			return e.Header
+		}
+		return nil
+	}
+	return nil
+}
+
+// FileEvents returns an iterator over the events in log files. Compressed
+// files are decompressed. Rotated files of one log, such as app.log.2.gz,
+// app.log.1.gz and app.log, are read oldest first as a single stream, so
+// operations spanning a rotation pair up; see GroupRotated for which files
+// are taken as rotated. Separate logs are merged by timestamp and their
+// events labelled with the live file name, or with the newest file's name
+// where sets share one, see Merge. Traces are resolved as by ResolveTraces,
+// and a *LineError names the file it occurred in. Files are opened as they
+// are reached; failing to open one ends the iteration with an error.
+func FileEvents(paths ...string) iter.Seq2[deadlog.Event, error] {
+	groups := GroupRotated(paths)
+	if len(groups) == 1 {
+		return rotatedEvents(groups[0])
+	}
+	bases := make(map[string]int)
+	for _, set := range groups {
+		bases[parseRotation(set[0]).base]++
+	}
+	streams := make([]iter.Seq2[deadlog.Event, error], len(groups))
+	for i, set := range groups {
+		source := parseRotation(set[0]).base
+		if bases[source] > 1 {
+			source = set[len(set)-1]
+		}
+		streams[i] = WithSource(source, rotatedEvents(set))
+	}
+	return Merge(streams...)
+}
+
+// rotatedEvents reads the files of a rotated set in order, as one log.
+func rotatedEvents(paths []string) iter.Seq2[deadlog.Event, error] {
+	files := func(yield func(deadlog.Event, error) bool) {
+		for _, path := range paths {
+			r, err := OpenLog(path)
+			if err != nil {
+				yield(deadlog.Event{}, err)
+				return
+			}
+			for e, err := range Events(r) {
+				var lineErr *LineError
+				if errors.As(err, &lineErr) {
+					lineErr.Source = path
+				}
+				if !yield(e, err) {
+					r.Close()
+					return
+				}
+			}
+			if err := r.Close(); err != nil {
+				yield(deadlog.Event{}, err)
+				return
+			}
+		}
+	}
+	return ResolveTraces(files)
+}
+
+// AnalyzeFiles analyzes log files read as by FileEvents.
+func AnalyzeFiles(paths ...string) (*Result, error) {
+	return AnalyzeEvents(FileEvents(paths...))
+}
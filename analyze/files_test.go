@@ -0,0 +1,215 @@
+package analyze
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeLog(t *testing.T, path, content string, compress bool) {
+	t.Helper()
+	data := []byte(content)
+	if compress {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		gz.Close()
+		data = buf.Bytes()
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	const content = `{"type":"LOCK","state":"START","name":"a","id":1,"ts":1}` + "\n"
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(content))
+	gz.Close()
+
+	for name, input := range map[string][]byte{
+		"plain": []byte(content),
+		"gzip":  buf.Bytes(),
+		"short": []byte("{"),
+		"empty": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			r, err := Decompress(bytes.NewReader(input))
+			if err != nil {
+				t.Fatalf("Decompress error: %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := string(input)
+			if name == "gzip" {
+				want = content
+			}
+			if string(got) != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestGroupRotated(t *testing.T) {
+	got := GroupRotated([]string{
+		"app.log", "app.log.10.gz", "app.log.2.gz", "app.log.1",
+		"sidecar.log-20240102.gz", "sidecar.log", "sidecar.log-20240101.gz",
+		"app.log",
+	})
+	want := [][]string{
+		{"app.log.10.gz", "app.log.2.gz", "app.log.1", "app.log"},
+		{"sidecar.log-20240101.gz", "sidecar.log-20240102.gz", "sidecar.log"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestGroupRotated_Unrelated(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	header := func(pid int) string {
+		return fmt.Sprintf(`{"type":"HEADER","ts":1,"header":{"schema":1,"pid":%d,"go_version":"go1.25","start":1}}`+"\n", pid)
+	}
+
+	// Replicas named worker.1 and worker.2 are separate processes.
+	writeLog(t, path("worker.1"), header(1), false)
+	writeLog(t, path("worker.2"), header(2), false)
+	// Files rotated by one process share its header.
+	writeLog(t, path("svc-20261018"), header(3), false)
+	writeLog(t, path("svc-20261019"), header(3), false)
+	// Without headers or the live file, nothing shows they belong together.
+	writeLog(t, path("job.1"), "", false)
+	writeLog(t, path("job.2"), "", false)
+
+	got := GroupRotated([]string{
+		path("worker.1"), path("worker.2"),
+		path("svc-20261019"), path("svc-20261018"),
+		path("job.1"), path("job.2"),
+	})
+	want := [][]string{
+		{path("worker.1")},
+		{path("worker.2")},
+		{path("svc-20261018"), path("svc-20261019")},
+		{path("job.1")},
+		{path("job.2")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// Unrelated replicas are merged as separate sources, so the same ID in
+	// both doesn't pair up.
+	writeLog(t, path("worker.1"), header(1)+`{"type":"LOCK","state":"START","name":"a","id":1,"ts":10}`+"\n", false)
+	writeLog(t, path("worker.2"), header(2)+`{"type":"LOCK","state":"START","name":"a","id":1,"ts":20}
+{"type":"LOCK","state":"ACQUIRED","name":"a","id":1,"ts":30}
+`, false)
+	result, err := AnalyzeFiles(path("worker.1"), path("worker.2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Stuck) != 1 || result.Stuck[0].Source != path("worker.1") {
+		t.Errorf("expected ID 1 stuck in worker.1, got %+v", result.Stuck)
+	}
+	if len(result.Held) != 1 || result.Held[0].Source != path("worker.2") {
+		t.Errorf("expected ID 1 held in worker.2, got %+v", result.Held)
+	}
+}
+
+func TestAnalyzeFiles_Rotated(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	// ID 1 is acquired before the first rotation and released after the
+	// second; ID 2 starts in the middle file and never acquires.
+	writeLog(t, path("app.log.2.gz"), `{"type":"LOCK","state":"START","name":"cache","id":1,"ts":100}
+{"type":"LOCK","state":"ACQUIRED","name":"cache","id":1,"ts":150}
+`, true)
+	writeLog(t, path("app.log.1.gz"), `{"type":"LOCK","state":"START","name":"cache","id":2,"ts":200}
+{"type":"LOCK","state":"ACQUIRED","name":"cache",
+`, true)
+	// The live file has no trailing newline yet.
+	writeLog(t, path("app.log"), `{"type":"LOCK","state":"RELEASED","name":"cache","id":1,"ts":300}`, false)
+
+	result, err := AnalyzeFiles(path("app.log"), path("app.log.1.gz"), path("app.log.2.gz"))
+	if err != nil {
+		t.Fatalf("AnalyzeFiles error: %v", err)
+	}
+	if len(result.Held) != 0 {
+		t.Errorf("expected ID 1 to pair up across rotations, got held %+v", result.Held)
+	}
+	if len(result.Stuck) != 1 || result.Stuck[0].ID != 2 || result.Stuck[0].Source != "" {
+		t.Errorf("expected ID 2 stuck without a source label, got %+v", result.Stuck)
+	}
+	if len(result.Malformed) != 1 || result.Malformed[0].Line != 2 || result.Malformed[0].Source != path("app.log.1.gz") {
+		t.Errorf("expected malformed line 2 of app.log.1.gz, got %v", result.Malformed)
+	}
+	if want := path("app.log.1.gz") + ":2"; result.MalformedString() != want {
+		t.Errorf("expected the malformed line as %s, got %s", want, result.MalformedString())
+	}
+
+	var lineErr *LineError
+	for _, err := range FileEvents(path("app.log"), path("app.log.1.gz"), path("app.log.2.gz")) {
+		if errors.As(err, &lineErr) {
+			break
+		}
+	}
+	if lineErr == nil || lineErr.Source != path("app.log.1.gz") {
+		t.Errorf("expected the line error to name app.log.1.gz, got %v", lineErr)
+	}
+
+	// A separate log is merged and labelled.
+	writeLog(t, path("other.log"), `{"type":"LOCK","state":"START","name":"cache","id":1,"ts":250}`+"\n", false)
+	if _, err := AnalyzeFiles(path("missing.log"), path("other.log")); err == nil {
+		t.Error("expected an error for a file that doesn't exist")
+	}
+	result, err = AnalyzeFiles(path("app.log"), path("app.log.1.gz"), path("app.log.2.gz"), path("other.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sources []string
+	for _, info := range result.Stuck {
+		sources = append(sources, filepath.Base(info.Source))
+	}
+	if strings.Join(sources, ",") != "app.log,other.log" {
+		t.Errorf("expected stuck locks in app.log and other.log, got %v", sources)
+	}
+}
+
+func TestAnalyzeFiles_MalformedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	writeLog(t, path("a.log"), `{"type":"LOCK","state":"START","name":"a","id":1,"ts":1}
+{"type":"LOCK","state":
+`, false)
+	writeLog(t, path("b.log"), `{"type":"LOCK","state":
+`, false)
+
+	result, err := AnalyzeFiles(path("a.log"), path("b.log"))
+	if err != nil {
+		t.Fatalf("AnalyzeFiles error: %v", err)
+	}
+	if len(result.Malformed) != 2 || result.Malformed[0].Source != path("a.log") || result.Malformed[1].Source != path("b.log") {
+		t.Errorf("expected a malformed line in each file, got %v", result.Malformed)
+	}
+	want := path("a.log") + ":2, " + path("b.log") + ":1"
+	if got := result.MalformedString(); got != want {
+		t.Errorf("expected malformed lines %s, got %s", want, got)
+	}
+	var buf strings.Builder
+	PrintReport(&buf, result)
+	if !strings.Contains(buf.String(), "Lines: "+want) {
+		t.Errorf("expected the report to name the files:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,58 @@
+package analyze
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Values for WriteFolded.
+const (
+	FoldedWait = "wait"
+	FoldedHold = "hold"
+)
+
+// WriteFolded writes spans as folded stacks for flame graph tools, one
+// "frame;frame;name value" line per distinct stack. Frames run from the
+// outermost caller to the lock name, and value is the total wait or hold
+// time in nanoseconds as selected by value. Stacks come from Event.Frames,
+// or Event.Trace when no frames were logged. Waits and holds still open at
+// the end of the log are counted up to the last event.
+func WriteFolded(w io.Writer, spans []Span, value string) error {
+	if value != FoldedWait && value != FoldedHold {
+		return fmt.Errorf("unknown value %q (want %s or %s)", value, FoldedWait, FoldedHold)
+	}
+	_, end := timeRange(spans)
+
+	totals := make(map[string]int64)
+	for _, s := range spans {
+		wait, hold := spanTimes(s, end)
+		v := wait
+		if value == FoldedHold {
+			v = hold
+		}
+		if v == 0 {
+			continue
+		}
+		var frames []string
+		for _, f := range slices.Backward(spanStack(s)) {
+			frames = append(frames, f.Func)
+		}
+		frames = append(frames, displayName(s.Name))
+		totals[strings.Join(frames, ";")] += v
+	}
+
+	stacks := make([]string, 0, len(totals))
+	for stack := range totals {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(w, "%s %d\n", stack, totals[stack]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
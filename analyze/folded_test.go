@@ -0,0 +1,46 @@
+package analyze
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteFolded(t *testing.T) {
+	input := `{"type":"LOCK","state":"START","name":"a","id":1,"trace":"update:25 <- main:12","ts":1000}
+{"type":"LOCK","state":"ACQUIRED","name":"a","id":1,"ts":3000}
+{"type":"LOCK","state":"RELEASED","name":"a","id":1,"ts":8000}
+{"type":"LOCK","state":"START","name":"a","id":2,"trace":"update:26 <- main:12","ts":8000}
+{"type":"LOCK","state":"ACQUIRED","name":"a","id":2,"ts":9000}
+{"type":"LOCK","state":"RELEASED","name":"a","id":2,"ts":10000}
+{"type":"LOCK","state":"START","name":"b","id":3,"frames":[{"func":"pkg.Inner","file":"x.go","line":1},{"func":"pkg.Outer","file":"x.go","line":9}],"ts":1000}
+{"type":"LOCK","state":"ACQUIRED","name":"b","id":3,"ts":1000}
+`
+	spans, err := Spans(Events(strings.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{FoldedWait, "main;update;a 3000\n"},
+		{FoldedHold, "main;update;a 6000\npkg.Outer;pkg.Inner;b 9000\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteFolded(&buf, spans, tt.value); err != nil {
+				t.Fatalf("WriteFolded error: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.want, buf.String())
+			}
+		})
+	}
+
+	if err := WriteFolded(&bytes.Buffer{}, spans, "bogus"); err == nil {
+		t.Error("expected an error for an unknown value")
+	}
+}
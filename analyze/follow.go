@@ -0,0 +1,123 @@
+package analyze
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPollInterval is how often a Follower checks a file for new data.
+const DefaultPollInterval = 250 * time.Millisecond
+
+// Follower reads a growing file like tail -F. At the end of the file, Read
+// waits for more data instead of returning io.EOF. If the file is rotated
+// (renamed or removed and recreated) Follower finishes the old file and
+// continues with the new one from the start; if it is truncated, it starts
+// over from the beginning.
+type Follower struct {
+	path string
+	poll time.Duration
+
+	f      *os.File
+	info   os.FileInfo
+	offset int64
+
+	caughtUp  atomic.Bool
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Follow opens path for following, starting at the beginning of the file.
+func Follow(path string) (*Follower, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Follower{
+		path:   path,
+		poll:   DefaultPollInterval,
+		f:      f,
+		info:   info,
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// CaughtUp reports whether the follower has reached the end of the file at
+// least once, meaning everything read from now on is live.
+func (fl *Follower) CaughtUp() bool {
+	return fl.caughtUp.Load()
+}
+
+// Read reads the next available data, waiting for the file to grow.
+// It returns io.EOF only after Close.
+func (fl *Follower) Read(p []byte) (int, error) {
+	for {
+		select {
+		case <-fl.closed:
+			return 0, io.EOF
+		default:
+		}
+
+		n, err := fl.f.Read(p)
+		fl.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+
+		fl.caughtUp.Store(true)
+		if err := fl.checkRotation(); err != nil {
+			return 0, err
+		}
+
+		select {
+		case <-fl.closed:
+			return 0, io.EOF
+		case <-time.After(fl.poll):
+		}
+	}
+}
+
+// checkRotation switches to a new file if the path now refers to one, or
+// rewinds if the file was truncated. It is called at the end of the file.
+func (fl *Follower) checkRotation() error {
+	info, err := os.Stat(fl.path)
+	if err != nil {
+		// The file may be briefly missing while it is being rotated.
+		return nil
+	}
+	if !os.SameFile(fl.info, info) {
+		f, err := os.Open(fl.path)
+		if err != nil {
+			return nil
+		}
+		// Anything written to the old file before the switch has already
+		// been read, since we're at its end.
+		fl.f.Close()
+		fl.f, fl.info, fl.offset = f, info, 0
+		return nil
+	}
+	if info.Size() < fl.offset {
+		if _, err := fl.f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		fl.offset = 0
+	}
+	return nil
+}
+
+// Close stops following and makes pending and future reads return io.EOF.
+func (fl *Follower) Close() error {
+	fl.closeOnce.Do(func() { close(fl.closed) })
+	return nil
+}
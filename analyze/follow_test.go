@@ -0,0 +1,144 @@
+package analyze
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestFollower(t *testing.T, path string) (*Follower, *bufio.Reader) {
+	t.Helper()
+	fl, err := Follow(path)
+	if err != nil {
+		t.Fatalf("Follow error: %v", err)
+	}
+	fl.poll = 10 * time.Millisecond
+	t.Cleanup(func() { fl.Close() })
+	return fl, bufio.NewReader(fl)
+}
+
+func readLine(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := r.ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a line")
+		return ""
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollower_Grow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "one\n")
+
+	fl, r := newTestFollower(t, path)
+	if got := readLine(t, r); got != "one\n" {
+		t.Errorf("expected first line, got %q", got)
+	}
+
+	if fl.CaughtUp() {
+		t.Error("follower has not hit the end of the file yet")
+	}
+
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := r.ReadString('\n')
+		lines <- line
+	}()
+	for !fl.CaughtUp() {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	appendFile(t, path, "two\n")
+	select {
+	case got := <-lines:
+		if got != "two\n" {
+			t.Errorf("expected appended line, got %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for appended line")
+	}
+}
+
+func TestFollower_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "old\n")
+
+	_, r := newTestFollower(t, path)
+	if got := readLine(t, r); got != "old\n" {
+		t.Errorf("expected line from old file, got %q", got)
+	}
+
+	if err := os.Rename(path, filepath.Join(dir, "app.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "new\n")
+	if got := readLine(t, r); got != "new\n" {
+		t.Errorf("expected line from new file, got %q", got)
+	}
+}
+
+func TestFollower_Truncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "a long first line\n")
+
+	_, r := newTestFollower(t, path)
+	readLine(t, r)
+	time.Sleep(30 * time.Millisecond)
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	appendFile(t, path, "short\n")
+	if got := readLine(t, r); got != "short\n" {
+		t.Errorf("expected line after truncation, got %q", got)
+	}
+}
+
+func TestFollower_Close(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "")
+
+	fl, err := Follow(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := fl.Read(make([]byte, 10))
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	fl.Close()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected io.EOF after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Read did not return after Close")
+	}
+}
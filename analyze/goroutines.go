@@ -0,0 +1,313 @@
+package analyze
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stevenctl/deadlog"
+)
+
+// Goroutine is a goroutine from a Go traceback, as printed on SIGQUIT, by
+// "fatal error: all goroutines are asleep - deadlock!", or by runtime.Stack
+// with all set.
+type Goroutine struct {
+	ID     int64           // goroutine ID
+	State  string          // what it is doing, e.g. "sync.RWMutex.Lock" or "running"
+	Wait   time.Duration   // how long it has been blocked, in whole minutes; 0 if under a minute
+	Frames []deadlog.Frame // stack, innermost first
+
+	CreatedBy *deadlog.Frame // the go statement that started it, if known
+}
+
+var (
+	goroutineHeader = regexp.MustCompile(`^goroutine (\d+)(?: [^\[]*)? \[(.*)\]:$`)
+	waitMinutes     = regexp.MustCompile(`^(\d+) minutes?$`)
+	frameLocation   = regexp.MustCompile(`^\t(.+?):(\d+)(?: .*)?$`)
+)
+
+// ParseGoroutines reads the goroutines of a Go traceback. Lines that aren't
+// part of one, such as the program's own output before a dump, are skipped.
+func ParseGoroutines(r io.Reader) ([]Goroutine, error) {
+	var (
+		out     []Goroutine
+		current *Goroutine
+		fn      string // function waiting for its location line
+		created bool   // whether fn is a "created by" line
+	)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if m := goroutineHeader.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.ParseInt(m[1], 10, 64)
+			state, wait := parseGoroutineState(m[2])
+			out = append(out, Goroutine{ID: id, State: state, Wait: wait})
+			current, fn = &out[len(out)-1], ""
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		switch {
+		case line == "":
+			// A blank line ends the goroutine.
+			current, fn = nil, ""
+		case fn != "":
+			if m := frameLocation.FindStringSubmatch(line); m != nil {
+				n, _ := strconv.Atoi(m[2])
+				f := deadlog.Frame{Func: fn, File: m[1], Line: n}
+				if created {
+					current.CreatedBy = &f
+				} else {
+					current.Frames = append(current.Frames, f)
+				}
+			}
+			fn = ""
+		case strings.HasPrefix(line, "created by "):
+			name := strings.TrimPrefix(line, "created by ")
+			if i := strings.Index(name, " in goroutine "); i >= 0 {
+				name = name[:i]
+			}
+			fn, created = name, true
+		case !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, "..."):
+			fn, created = frameFunc(line), false
+		}
+	}
+	return out, sc.Err()
+}
+
+// ParseGoroutinesFile reads the goroutines of a Go traceback from a file.
+func ParseGoroutinesFile(path string) ([]Goroutine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseGoroutines(f)
+}
+
+// parseGoroutineState splits "sync.RWMutex.Lock, 5 minutes, locked to
+// thread" into the state and the wait.
+func parseGoroutineState(s string) (string, time.Duration) {
+	var (
+		parts []string
+		wait  time.Duration
+	)
+	for _, part := range strings.Split(s, ", ") {
+		if m := waitMinutes.FindStringSubmatch(part); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			wait = time.Duration(n) * time.Minute
+			continue
+		}
+		if part == "locked to thread" {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", "), wait
+}
+
+// frameFunc returns the function of a traceback call line by removing its
+// arguments, e.g. "sync.(*RWMutex).Lock(0xc000012100)".
+func frameFunc(line string) string {
+	if i := strings.LastIndexByte(line, '('); i > 0 && strings.HasSuffix(line, ")") {
+		return line[:i]
+	}
+	return line
+}
+
+// lockFuncs are the functions a goroutine blocked on a lock waits in.
+var lockFuncs = map[string]bool{
+	"sync.(*RWMutex).Lock":  true,
+	"sync.(*RWMutex).RLock": true,
+	"sync.(*Mutex).Lock":    true,
+}
+
+// BlockedOnLock reports whether the goroutine is waiting to acquire a
+// sync.Mutex or sync.RWMutex, which is where a stuck deadlog.Mutex waits.
+func (g Goroutine) BlockedOnLock() bool {
+	for _, f := range g.Frames {
+		if lockFuncs[f.Func] {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchGoroutines attaches the goroutines of a dump taken while a process
+// hung to the findings of r from source, in LockInfo.Stack. Goroutine IDs
+// are only unique within a process, so only one source can be matched: the
+// one written by the process the dump is of, see DumpSource. An empty source
+// matches the findings of a log with a single source, and is an error if r
+// has findings from several.
+//
+// A stuck operation is matched to the goroutine with its ID, if logged
+// WithGoroutineID and found in the dump, or else to a goroutine blocked on a
+// lock whose stack contains the operation's stack. Held operations are only
+// matched by ID, showing what the holder is doing. Blocked goroutines that
+// match no stuck operation, such as ones waiting on a plain sync.Mutex, are
+// added to r.Blocked.
+func MatchGoroutines(r *Result, source string, goroutines []Goroutine) error {
+	if source == "" {
+		if sources := findingSources(r); len(sources) > 1 {
+			return fmt.Errorf("findings from %d sources, the goroutine dump must be matched to one of %s", len(sources), strings.Join(sources, ", "))
+		}
+	}
+	ofSource := func(info LockInfo) bool {
+		return source == "" || info.Source == source
+	}
+
+	byID := make(map[int64]int, len(goroutines))
+	for i, g := range goroutines {
+		byID[g.ID] = i
+	}
+	used := make([]bool, len(goroutines))
+	attach := func(info *LockInfo, i int) {
+		g := goroutines[i]
+		info.Stack = &g
+		used[i] = true
+	}
+
+	for i := range r.Held {
+		if !ofSource(r.Held[i]) {
+			continue
+		}
+		if j, ok := byID[r.Held[i].Goroutine]; ok && r.Held[i].Goroutine != 0 {
+			attach(&r.Held[i], j)
+		}
+	}
+	// Match IDs first so that stack matches can't take their goroutines.
+	var byStack []*LockInfo
+	for i := range r.Stuck {
+		info := &r.Stuck[i]
+		if !ofSource(*info) {
+			continue
+		}
+		if j, ok := byID[info.Goroutine]; ok && info.Goroutine != 0 {
+			attach(info, j)
+		} else {
+			byStack = append(byStack, info)
+		}
+	}
+	for _, info := range byStack {
+		want := lockStack(*info)
+		if len(want) == 0 {
+			continue
+		}
+		for j, g := range goroutines {
+			if !used[j] && g.BlockedOnLock() && containsStack(g.Frames, want) {
+				attach(info, j)
+				break
+			}
+		}
+	}
+
+	for j, g := range goroutines {
+		if g.BlockedOnLock() && !used[j] {
+			r.Blocked = append(r.Blocked, g)
+		}
+	}
+	return nil
+}
+
+// findingSources returns the sources of the stuck and held operations of r,
+// sorted.
+func findingSources(r *Result) []string {
+	seen := make(map[string]bool)
+	for _, info := range slices.Concat(r.Stuck, r.Held) {
+		seen[info.Source] = true
+	}
+	return slices.Sorted(maps.Keys(seen))
+}
+
+// DumpSource returns the source of the findings of r that were written by
+// the process with header h, such as the header of a goroutine dump written
+// by deadlog.WriteState, for MatchGoroutines. It is an error if no current
+// session of r, or more than one, is of that process.
+func DumpSource(r *Result, h *deadlog.Header) (string, error) {
+	var sources []string
+	for _, s := range r.Sessions {
+		if !s.Ended && s.Header != nil && s.Header.SameProcess(h) && !slices.Contains(sources, s.Source) {
+			sources = append(sources, s.Source)
+		}
+	}
+	switch len(sources) {
+	case 0:
+		return "", fmt.Errorf("no log of process %d", h.PID)
+	case 1:
+		return sources[0], nil
+	default:
+		return "", fmt.Errorf("several logs of process %d: %s", h.PID, strings.Join(sources, ", "))
+	}
+}
+
+// lockStack returns the stack an operation was logged with, innermost
+// first. Frames from a trace only have the last element of the function.
+func lockStack(info LockInfo) []deadlog.Frame {
+	if len(info.Frames) > 0 {
+		return info.Frames
+	}
+	var frames []deadlog.Frame
+	for _, f := range parseTrace(info.Trace) {
+		frames = append(frames, deadlog.Frame{Func: f.Func, Line: f.Line})
+	}
+	return frames
+}
+
+// containsStack reports whether want appears in frames as consecutive
+// frames, comparing function and line, and only the last element of the
+// function for frames without a file, which come from a trace. All of want
+// must match, except for runtime frames such as runtime.goexit past the end
+// of the dump's stack, which tracebacks leave out but stacks logged by
+// deadlog have.
+func containsStack(frames, want []deadlog.Frame) bool {
+	for start := range frames {
+		n := 0
+		for n < len(want) && start+n < len(frames) && sameFrame(frames[start+n], want[n]) {
+			n++
+		}
+		if n == len(want) || start+n == len(frames) && runtimeFrames(want[n:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// runtimeFrames reports whether all frames are in the runtime. Frames from
+// a trace only have the last element of the function, so runtime.goexit is
+// recognised by that alone.
+func runtimeFrames(frames []deadlog.Frame) bool {
+	for _, f := range frames {
+		if !strings.HasPrefix(f.Func, "runtime.") && (f.File != "" || f.Func != "goexit") {
+			return false
+		}
+	}
+	return true
+}
+
+func sameFrame(f, want deadlog.Frame) bool {
+	if f.Line != want.Line {
+		return false
+	}
+	if want.File == "" {
+		return shortFunc(f.Func) == want.Func
+	}
+	return f.Func == want.Func
+}
+
+// shortFunc returns the last dot-separated element of a function, as used
+// in traces.
+func shortFunc(fn string) string {
+	if i := strings.LastIndex(fn, "."); i >= 0 {
+		return fn[i+1:]
+	}
+	return fn
+}
@@ -0,0 +1,227 @@
+package analyze
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stevenctl/deadlog"
+)
+
+func TestParseGoroutines(t *testing.T) {
+	gs, err := ParseGoroutinesFile("testdata/goroutines.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gs) != 4 {
+		t.Fatalf("expected 4 goroutines, got %d", len(gs))
+	}
+
+	g := gs[1]
+	if g.ID != 8 || g.State != "sync.RWMutex.Lock" || g.Wait != 2*time.Minute {
+		t.Errorf("expected goroutine 8 locking for 2m, got %d %q %s", g.ID, g.State, g.Wait)
+	}
+	if len(g.Frames) != 6 {
+		t.Fatalf("expected 6 frames, got %+v", g.Frames)
+	}
+	want := deadlog.Frame{Func: "main.main.func1", File: "/app/main.go", Line: 17}
+	if g.Frames[4] != want {
+		t.Errorf("expected frame %v, got %v", want, g.Frames[4])
+	}
+	if g.Frames[1].Func != "runtime.goparkunlock" || g.Frames[1].Line != 480 {
+		t.Errorf("expected the inlined frame, got %v", g.Frames[1])
+	}
+	if g.CreatedBy == nil || g.CreatedBy.Func != "main.main" || g.CreatedBy.Line != 16 {
+		t.Errorf("expected created by main.main:16, got %v", g.CreatedBy)
+	}
+
+	if g := gs[3]; g.State != "sync.Mutex.Lock" || g.Wait != 5*time.Minute || len(g.Frames) != 3 {
+		t.Errorf("expected goroutine 10 with 3 frames locking for 5m, got %q %s %+v", g.State, g.Wait, g.Frames)
+	}
+	for i, blocked := range []bool{false, true, true, true} {
+		if gs[i].BlockedOnLock() != blocked {
+			t.Errorf("goroutine %d: expected BlockedOnLock %v", gs[i].ID, blocked)
+		}
+	}
+}
+
+func TestMatchGoroutines(t *testing.T) {
+	gs, err := ParseGoroutinesFile("testdata/goroutines.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Result{
+		Stuck: []LockInfo{
+			{Type: "WLOCK", Name: "by-id", ID: 1, Goroutine: 8},
+			{Type: "RLOCK", Name: "by-trace", ID: 2, Trace: "read:42 <- serve:30"},
+			{Type: "LOCK", Name: "no-match", ID: 3, Frames: []deadlog.Frame{{Func: "main.other", File: "/app/main.go", Line: 1}}},
+		},
+		Held: []LockInfo{
+			{Type: "LOCK", Name: "holder", ID: 4, Goroutine: 1},
+		},
+	}
+	if err := MatchGoroutines(r, "", gs); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, wantID := range []int64{8, 9, 0} {
+		got := r.Stuck[i].Stack
+		switch {
+		case wantID == 0 && got != nil:
+			t.Errorf("%s: expected no goroutine, got %d", r.Stuck[i].Name, got.ID)
+		case wantID != 0 && (got == nil || got.ID != wantID):
+			t.Errorf("%s: expected goroutine %d, got %+v", r.Stuck[i].Name, wantID, got)
+		}
+	}
+	if got := r.Held[0].Stack; got == nil || got.ID != 1 {
+		t.Errorf("expected the holder matched to goroutine 1, got %+v", got)
+	}
+	if len(r.Blocked) != 1 || r.Blocked[0].ID != 10 {
+		t.Errorf("expected goroutine 10 to be blocked without an event, got %+v", r.Blocked)
+	}
+
+	var buf strings.Builder
+	PrintReport(&buf, r)
+	for _, want := range []string{
+		"Goroutine 8 [sync.RWMutex.Lock, blocked 2m0s]:",
+		"main.(*Server).read",
+		"=== BLOCKED",
+		"Goroutine 10 [sync.Mutex.Lock, blocked 5m0s]:",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected report to contain %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestContainsStack(t *testing.T) {
+	dump := []deadlog.Frame{
+		{Func: "sync.(*Mutex).Lock", File: "/go/src/sync/mutex.go", Line: 81},
+		{Func: "main.read", File: "/app/main.go", Line: 42},
+		{Func: "main.serve", File: "/app/main.go", Line: 30},
+	}
+	read := deadlog.Frame{Func: "main.read", File: "/app/main.go", Line: 42}
+	serve := deadlog.Frame{Func: "main.serve", File: "/app/main.go", Line: 30}
+	other := deadlog.Frame{Func: "main.other", File: "/app/main.go", Line: 7}
+	goexit := deadlog.Frame{Func: "runtime.goexit", File: "/go/src/runtime/asm_amd64.s", Line: 1700}
+
+	for _, tt := range []struct {
+		name string
+		want []deadlog.Frame
+		ok   bool
+	}{
+		{"whole stack", []deadlog.Frame{read, serve}, true},
+		{"runtime frames past the end", []deadlog.Frame{read, serve, goexit}, true},
+		{"trace frames", []deadlog.Frame{{Func: "serve", Line: 30}, {Func: "goexit", Line: 1700}}, true},
+		{"only the last frame overlaps", []deadlog.Frame{serve, other}, false},
+		{"different frame", []deadlog.Frame{read, other}, false},
+	} {
+		if got := containsStack(dump, tt.want); got != tt.ok {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.ok, got)
+		}
+	}
+}
+
+func TestMatchGoroutines_Sources(t *testing.T) {
+	gs, err := ParseGoroutinesFile("testdata/goroutines.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newResult := func() *Result {
+		return &Result{
+			Stuck: []LockInfo{
+				{Type: "WLOCK", Name: "a", ID: 1, Goroutine: 8, Source: "a.log"},
+				{Type: "WLOCK", Name: "b", ID: 1, Goroutine: 8, Source: "b.log"},
+				// Not in the dump, so matched by its trace instead.
+				{Type: "RLOCK", Name: "c", ID: 2, Goroutine: 99, Trace: "read:42 <- serve:30", Source: "b.log"},
+			},
+			Sessions: []Session{
+				{Source: "a.log", Header: &deadlog.Header{PID: 1, Start: 1}},
+				{Source: "b.log", Header: &deadlog.Header{PID: 2, Start: 1}, Ended: true},
+				{Source: "b.log", Header: &deadlog.Header{PID: 3, Start: 1}},
+			},
+		}
+	}
+
+	// Goroutine 8 of one process says nothing about goroutine 8 of another.
+	r := newResult()
+	if err := MatchGoroutines(r, "", gs); err == nil {
+		t.Error("expected an error matching findings of several sources")
+	}
+	for _, info := range r.Stuck {
+		if info.Stack != nil {
+			t.Errorf("%s: expected no goroutine without a source, got %d", info.Name, info.Stack.ID)
+		}
+	}
+
+	source, err := DumpSource(r, &deadlog.Header{PID: 3, Start: 1})
+	if err != nil || source != "b.log" {
+		t.Fatalf("expected the dump of process 3 to be b.log, got %q, %v", source, err)
+	}
+	if _, err := DumpSource(r, &deadlog.Header{PID: 2, Start: 1}); err == nil {
+		t.Error("expected no current source for a restarted process")
+	}
+	if err := MatchGoroutines(r, source, gs); err != nil {
+		t.Fatal(err)
+	}
+	for i, wantID := range []int64{0, 8, 9} {
+		got := r.Stuck[i].Stack
+		switch {
+		case wantID == 0 && got != nil:
+			t.Errorf("%s: expected no goroutine, got %d", r.Stuck[i].Name, got.ID)
+		case wantID != 0 && (got == nil || got.ID != wantID):
+			t.Errorf("%s: expected goroutine %d, got %+v", r.Stuck[i].Name, wantID, got)
+		}
+	}
+}
+
+func TestMatchGoroutines_Live(t *testing.T) {
+	for name, opt := range map[string]deadlog.Option{
+		"frames":    deadlog.WithFrames(3),
+		"trace":     deadlog.WithTrace(3),
+		"goroutine": deadlog.WithGoroutineID(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			tracker := NewTracker()
+			m := deadlog.New(opt, deadlog.WithLogger(tracker.Observe))
+			unlock := m.LockFunc()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				m.LockFunc()()
+			}()
+
+			// Wait for the second LockFunc to block, then take the findings
+			// and a dump as a hung process would have them.
+			var dump string
+			for start := time.Now(); ; time.Sleep(time.Millisecond) {
+				buf := make([]byte, 1<<20)
+				dump = string(buf[:runtime.Stack(buf, true)])
+				if strings.Contains(dump, "sync.(*RWMutex).Lock") {
+					break
+				}
+				if time.Since(start) > 10*time.Second {
+					t.Fatal("timed out waiting for the goroutine to block")
+				}
+			}
+			r := tracker.Result()
+			unlock()
+			<-done
+
+			gs, err := ParseGoroutines(strings.NewReader(dump))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(r.Stuck) != 1 {
+				t.Fatalf("expected one stuck operation, got %+v", r.Stuck)
+			}
+			if err := MatchGoroutines(r, "", gs); err != nil {
+				t.Fatal(err)
+			}
+			if g := r.Stuck[0].Stack; g == nil || !g.BlockedOnLock() {
+				t.Errorf("expected the stuck operation matched to its goroutine in:\n%s", dump)
+			}
+		})
+	}
+}
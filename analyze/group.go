@@ -0,0 +1,65 @@
+package analyze
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/stevenctl/deadlog"
+)
+
+// StackGroup is a set of findings that share the same structured stack.
+type StackGroup struct {
+	Frames []deadlog.Frame // the shared stack, innermost frame first
+	Stuck  []LockInfo      // stuck locks acquired from this stack
+	Held   []LockInfo      // held locks acquired from this stack
+}
+
+// stackKey identifies a stack by its fully-qualified frames.
+func stackKey(frames []deadlog.Frame) string {
+	parts := make([]string, len(frames))
+	for i, f := range frames {
+		parts[i] = f.String()
+	}
+	return strings.Join(parts, "\n")
+}
+
+// GroupByStack groups the stuck and held locks of r by their structured
+// frames. Findings without frames are not grouped. Groups are sorted by the
+// number of findings, largest first.
+func GroupByStack(r *Result) []StackGroup {
+	groups := make(map[string]*StackGroup)
+	get := func(info LockInfo) *StackGroup {
+		key := stackKey(info.Frames)
+		g, ok := groups[key]
+		if !ok {
+			g = &StackGroup{Frames: info.Frames}
+			groups[key] = g
+		}
+		return g
+	}
+	for _, info := range r.Stuck {
+		if len(info.Frames) > 0 {
+			g := get(info)
+			g.Stuck = append(g.Stuck, info)
+		}
+	}
+	for _, info := range r.Held {
+		if len(info.Frames) > 0 {
+			g := get(info)
+			g.Held = append(g.Held, info)
+		}
+	}
+
+	out := make([]StackGroup, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		ni, nj := len(out[i].Stuck)+len(out[i].Held), len(out[j].Stuck)+len(out[j].Held)
+		if ni != nj {
+			return ni > nj
+		}
+		return stackKey(out[i].Frames) < stackKey(out[j].Frames)
+	})
+	return out
+}
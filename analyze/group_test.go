@@ -0,0 +1,47 @@
+package analyze
+
+import (
+	"testing"
+
+	"github.com/stevenctl/deadlog"
+)
+
+func TestGroupByStack(t *testing.T) {
+	a := []deadlog.Frame{{Func: "example.com/pkg.(*Store).Update", File: "/src/store.go", Line: 10}}
+	b := []deadlog.Frame{{Func: "example.com/other.(*Store).Update", File: "/src/other.go", Line: 10}}
+
+	result := &Result{
+		Stuck: []LockInfo{
+			{Type: "LOCK", Name: "s", ID: 1, Frames: a},
+			{Type: "LOCK", Name: "s", ID: 2, Frames: a},
+			{Type: "LOCK", Name: "s", ID: 3, Trace: "Update:10"},
+		},
+		Held: []LockInfo{
+			{Type: "LOCK", Name: "s", ID: 4, Frames: b},
+			{Type: "LOCK", Name: "s", ID: 5, Frames: a},
+		},
+	}
+
+	groups := GroupByStack(result)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups (same short name, different packages), got %d", len(groups))
+	}
+	if groups[0].Frames[0].Func != a[0].Func {
+		t.Errorf("expected largest group first, got %s", groups[0].Frames[0].Func)
+	}
+	if len(groups[0].Stuck) != 2 || len(groups[0].Held) != 1 {
+		t.Errorf("expected 2 stuck and 1 held in first group, got %d and %d", len(groups[0].Stuck), len(groups[0].Held))
+	}
+	if len(groups[1].Stuck) != 0 || len(groups[1].Held) != 1 {
+		t.Errorf("expected 0 stuck and 1 held in second group, got %d and %d", len(groups[1].Stuck), len(groups[1].Held))
+	}
+}
+
+func TestGroupByStack_NoFrames(t *testing.T) {
+	result := &Result{
+		Stuck: []LockInfo{{Type: "LOCK", Name: "s", ID: 1, Trace: "Update:10"}},
+	}
+	if groups := GroupByStack(result); len(groups) != 0 {
+		t.Errorf("expected no groups without frames, got %d", len(groups))
+	}
+}
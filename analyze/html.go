@@ -0,0 +1,234 @@
+package analyze
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed report.html.tmpl
+var reportTemplate string
+
+var reportTmpl = template.Must(template.New("report").Parse(reportTemplate))
+
+// Timeline geometry in pixels.
+const (
+	timelineWidth = 1200
+	laneLabel     = 220
+	rowHeight     = 14
+	rowGap        = 4
+	lanePadding   = 8
+)
+
+type htmlReport struct {
+	Width, Height int
+	LabelWidth    int
+	Lanes         []htmlLane
+	Ticks         []htmlTick
+	Stuck         []LockInfo
+	Held          []LockInfo
+	Cycles        []htmlCycle
+	Spans         int
+	Duration      string
+}
+
+type htmlLane struct {
+	Name   string
+	Odd    bool
+	Y      int
+	Height int
+	Bars   []htmlBar
+}
+
+type htmlBar struct {
+	X, Y, W float64
+	Class   string
+	Title   string
+}
+
+type htmlCycle struct {
+	Path   string // lock names of the cycle, "a -> b -> a"
+	Source string
+	Edges  []LockOrder
+}
+
+type htmlTick struct {
+	X     float64
+	Label string
+}
+
+// WriteHTML writes a self-contained HTML page with a swimlane timeline per
+// lock name, showing wait and hold segments for each span, the lock order
+// cycles of r, highlighted above the rest, and its stuck and held locks.
+// Hovering a segment shows its ID, timing and trace.
+func WriteHTML(w io.Writer, spans []Span, r *Result) error {
+	report := htmlReport{
+		LabelWidth: laneLabel,
+		Width:      laneLabel + timelineWidth,
+		Stuck:      r.Stuck,
+		Held:       r.Held,
+		Spans:      len(spans),
+	}
+	for _, c := range r.Cycles {
+		report.Cycles = append(report.Cycles, htmlCycle{
+			Path:   strings.Join(c.Names(), " -> "),
+			Source: c.Source,
+			Edges:  c.Edges,
+		})
+	}
+
+	// Leave room after the last event so that locks still waiting or held
+	// at the end of the log are visible.
+	t0, t1 := timeRange(spans)
+	t1 += max((t1-t0)/10, int64(time.Millisecond))
+	scale := float64(timelineWidth) / float64(t1-t0)
+	x := func(ts int64) float64 {
+		return float64(laneLabel) + float64(ts-t0)*scale
+	}
+	report.Duration = time.Duration(t1 - t0).String()
+	for i := 0; i <= 5; i++ {
+		ts := t0 + (t1-t0)*int64(i)/5
+		report.Ticks = append(report.Ticks, htmlTick{X: x(ts), Label: "+" + time.Duration(ts-t0).String()})
+	}
+
+	byName := make(map[string][]Span)
+	for _, s := range spans {
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	y := 24 // room for the axis
+	for _, name := range names {
+		lane := htmlLane{Name: displayName(name), Odd: len(report.Lanes)%2 == 1, Y: y}
+		rows, n := packRows(byName[name], t1)
+		for i, s := range byName[name] {
+			by := float64(y + lanePadding + rows[i]*(rowHeight+rowGap))
+			for _, seg := range spanSegments(s, t1) {
+				lane.Bars = append(lane.Bars, htmlBar{
+					X:     x(seg.from),
+					Y:     by,
+					W:     max(x(seg.to)-x(seg.from), 2),
+					Class: seg.class,
+					Title: spanTitle(s, seg.class),
+				})
+			}
+		}
+		lane.Height = 2*lanePadding + n*(rowHeight+rowGap)
+		report.Lanes = append(report.Lanes, lane)
+		y += lane.Height
+	}
+	report.Height = y
+
+	return reportTmpl.Execute(w, report)
+}
+
+func timeRange(spans []Span) (int64, int64) {
+	var t0, t1 int64
+	for _, s := range spans {
+		for _, ts := range []int64{s.Start, s.Acquired, s.Released} {
+			if ts == 0 {
+				continue
+			}
+			if t0 == 0 || ts < t0 {
+				t0 = ts
+			}
+			t1 = max(t1, ts)
+		}
+	}
+	return t0, t1
+}
+
+// packRows stacks overlapping spans into rows, reusing the first free row.
+// It returns the row of each span and the number of rows used.
+func packRows(spans []Span, end int64) ([]int, int) {
+	rows := make([]int, len(spans))
+	var rowEnds []int64
+	for i, s := range spans {
+		row := 0
+		for row < len(rowEnds) && rowEnds[row] >= s.begin() {
+			row++
+		}
+		if row == len(rowEnds) {
+			rowEnds = append(rowEnds, 0)
+		}
+		rowEnds[row] = spanEnd(s, end)
+		rows[i] = row
+	}
+	return rows, len(rowEnds)
+}
+
+// spanEnd returns when a span stops occupying its row; outstanding spans
+// run to the end of the log.
+func spanEnd(s Span, end int64) int64 {
+	switch {
+	case s.Released != 0:
+		return s.Released
+	case s.Acquired != 0 && !isTrackedType(s.Type):
+		return s.Acquired
+	default:
+		return end
+	}
+}
+
+type segment struct {
+	from, to int64
+	class    string
+}
+
+// spanSegments splits a span into wait and hold segments. Stuck waits and
+// held locks run to the end of the log; untracked holds are a tick at the
+// acquisition since their release isn't logged.
+func spanSegments(s Span, end int64) []segment {
+	var segs []segment
+	if s.Start != 0 {
+		if s.Acquired != 0 {
+			segs = append(segs, segment{s.Start, s.Acquired, "wait"})
+		} else {
+			segs = append(segs, segment{s.Start, end, "stuck"})
+		}
+	}
+	if s.Acquired != 0 {
+		switch {
+		case s.Released != 0:
+			segs = append(segs, segment{s.Acquired, s.Released, "hold"})
+		case isTrackedType(s.Type):
+			segs = append(segs, segment{s.Acquired, end, "held"})
+		default:
+			segs = append(segs, segment{s.Acquired, s.Acquired, "untracked"})
+		}
+	}
+	return segs
+}
+
+func spanTitle(s Span, class string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s ID: %d (%s)", s.Type, displayName(s.Name), s.ID, class)
+	if d := s.Wait(); d > 0 {
+		fmt.Fprintf(&b, "\nwait: %s", time.Duration(d))
+	}
+	if d := s.Hold(); d > 0 {
+		fmt.Fprintf(&b, "\nhold: %s", time.Duration(d))
+	}
+	for _, f := range s.Frames {
+		fmt.Fprintf(&b, "\n%s %s:%d", f.Func, f.File, f.Line)
+	}
+	if len(s.Frames) == 0 && s.Trace != "" {
+		fmt.Fprintf(&b, "\nTrace: %s", s.Trace)
+	}
+	return b.String()
+}
+
+func displayName(name string) string {
+	if name == "" {
+		return "(unnamed)"
+	}
+	return name
+}
@@ -0,0 +1,101 @@
+package analyze
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTML(t *testing.T) {
+	input := `{"type":"LOCK","state":"START","name":"player-state","id":1,"trace":"updateHealth:25","ts":1000000}
+{"type":"LOCK","state":"ACQUIRED","name":"player-state","id":1,"trace":"updateHealth:25","ts":2000000}
+{"type":"LOCK","state":"START","name":"player-state","id":2,"trace":"applyDamage:33","ts":3000000}
+{"type":"RLOCK","state":"START","name":"<inventory>","id":3,"ts":1500000}
+{"type":"RLOCK","state":"ACQUIRED","name":"<inventory>","id":3,"ts":1600000}
+{"type":"RLOCK","state":"RELEASED","name":"<inventory>","id":3,"ts":2600000}
+`
+	spans, err := Spans(Events(strings.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Analyze(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, spans, result); err != nil {
+		t.Fatalf("WriteHTML error: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		`class="bar wait"`,
+		`class="bar held"`,
+		`class="bar stuck"`,
+		`class="bar hold"`,
+		"LOCK player-state ID: 2 (stuck)",
+		"Trace: applyDamage:33",
+		"&lt;inventory&gt;",
+		"1 stuck, 1 held",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report should contain %q", want)
+		}
+	}
+	if strings.Contains(out, "<inventory>") {
+		t.Error("names should be escaped")
+	}
+	// The page must not load anything from elsewhere.
+	for _, ref := range []string{"<script src", "<link", "http://", "https://"} {
+		if ref == "http://" && strings.Count(out, ref) == strings.Count(out, "http://www.w3.org/2000/svg") {
+			continue
+		}
+		if strings.Contains(out, ref) {
+			t.Errorf("report should be self-contained, found %q", ref)
+		}
+	}
+}
+
+func TestWriteHTML_Cycles(t *testing.T) {
+	input := `{"type":"LOCK","state":"START","name":"a","id":1,"ts":1000000}
+{"type":"LOCK","state":"ACQUIRED","name":"a","id":1,"ts":2000000}
+{"type":"LOCK","state":"RELEASED","name":"a","id":1,"ts":3000000}
+`
+	spans, err := Spans(Events(strings.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := LockInfo{Type: "LOCK", Name: "a", Goroutine: 7, Trace: "takeA:10"}
+	b := LockInfo{Type: "LOCK", Name: "b", Goroutine: 7, Trace: "takeB:20"}
+	result := &Result{Cycles: []Cycle{{Source: "app.log", Edges: []LockOrder{
+		{Held: a, Wanted: b},
+		{Held: b, Wanted: a},
+	}}}}
+
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, spans, result); err != nil {
+		t.Fatalf("WriteHTML error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`<div class="cycles">`,
+		"a -&gt; b -&gt; a (app.log)",
+		"<td>b</td><td>a</td><td>7</td><td class=\"trace\">takeB:20</td>",
+		"1 lock order cycles",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report should contain %q:\n%s", want, out)
+		}
+	}
+
+	// Without cycles, there is no section for them.
+	buf.Reset()
+	if err := WriteHTML(&buf, spans, &Result{}); err != nil {
+		t.Fatalf("WriteHTML error: %v", err)
+	}
+	if strings.Contains(buf.String(), `<div class="cycles">`) {
+		t.Error("expected no cycles section without cycles")
+	}
+}
@@ -0,0 +1,262 @@
+package analyze
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/stevenctl/deadlog"
+)
+
+// WritePprof writes a contention profile of spans in the pprof format, as
+// read by go tool pprof. Each sample is a stack with the number of lock
+// operations and their total wait and hold time in nanoseconds, with the lock
+// name as the leaf frame. Stacks come from Event.Frames, or Event.Trace when
+// no frames were logged. Waits and holds still open at the end of the log are
+// counted up to the last event. The output is gzip-compressed.
+func WritePprof(w io.Writer, spans []Span) error {
+	start, end := timeRange(spans)
+	p := newProfileBuilder()
+
+	for _, s := range spans {
+		stack := append([]deadlog.Frame{{Func: displayName(s.Name)}}, spanStack(s)...)
+		wait, hold := spanTimes(s, end)
+		p.add(stack, []int64{1, wait, hold})
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(p.encode(start, end-start)); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// spanTimes returns the time a span waited and held its lock in nanoseconds,
+// counting outstanding waits and holds up to end.
+func spanTimes(s Span, end int64) (wait, hold int64) {
+	for _, seg := range spanSegments(s, end) {
+		switch seg.class {
+		case "wait", "stuck":
+			wait += seg.to - seg.from
+		case "hold", "held":
+			hold += seg.to - seg.from
+		}
+	}
+	return wait, hold
+}
+
+// spanStack returns the stack of a span, innermost frame first.
+func spanStack(s Span) []deadlog.Frame {
+	if len(s.Frames) > 0 {
+		return s.Frames
+	}
+	var frames []deadlog.Frame
+	for _, f := range parseTrace(s.Trace) {
+		frames = append(frames, deadlog.Frame{Func: f.Func, Line: f.Line})
+	}
+	return frames
+}
+
+// profileBuilder aggregates samples by stack and encodes them as a
+// perftools.profiles.Profile message.
+type profileBuilder struct {
+	strings   []string
+	stringIdx map[string]int64
+	functions map[deadlog.Frame]uint64 // keyed without Line
+	locations map[deadlog.Frame]uint64
+	locOrder  []deadlog.Frame
+	funcOrder []deadlog.Frame
+	samples   map[string]*profileSample
+	order     []string
+}
+
+type profileSample struct {
+	locations []uint64
+	values    []int64
+}
+
+func newProfileBuilder() *profileBuilder {
+	return &profileBuilder{
+		strings:   []string{""},
+		stringIdx: map[string]int64{"": 0},
+		functions: make(map[deadlog.Frame]uint64),
+		locations: make(map[deadlog.Frame]uint64),
+		samples:   make(map[string]*profileSample),
+	}
+}
+
+func (p *profileBuilder) string(s string) int64 {
+	if i, ok := p.stringIdx[s]; ok {
+		return i
+	}
+	i := int64(len(p.strings))
+	p.strings = append(p.strings, s)
+	p.stringIdx[s] = i
+	return i
+}
+
+func (p *profileBuilder) location(f deadlog.Frame) uint64 {
+	if id, ok := p.locations[f]; ok {
+		return id
+	}
+	fn := deadlog.Frame{Func: f.Func, File: f.File}
+	if _, ok := p.functions[fn]; !ok {
+		p.functions[fn] = uint64(len(p.funcOrder) + 1)
+		p.funcOrder = append(p.funcOrder, fn)
+	}
+	id := uint64(len(p.locOrder) + 1)
+	p.locations[f] = id
+	p.locOrder = append(p.locOrder, f)
+	return id
+}
+
+// add adds values to the sample for stack, leaf first.
+func (p *profileBuilder) add(stack []deadlog.Frame, values []int64) {
+	var key strings.Builder
+	locs := make([]uint64, len(stack))
+	for i, f := range stack {
+		locs[i] = p.location(f)
+		key.WriteString(f.String())
+		key.WriteByte('\n')
+	}
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &profileSample{locations: locs, values: make([]int64, len(values))}
+		p.samples[key.String()] = s
+		p.order = append(p.order, key.String())
+	}
+	for i, v := range values {
+		s.values[i] += v
+	}
+}
+
+// Field numbers of the pprof protobuf messages.
+const (
+	profileSampleType        = 1
+	profileSamples           = 2
+	profileLocation          = 4
+	profileFunction          = 5
+	profileStringTable       = 6
+	profileTimeNanos         = 9
+	profileDurationNanos     = 10
+	profileDefaultSampleType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+)
+
+func (p *profileBuilder) encode(timeNanos, durationNanos int64) []byte {
+	var b protoBuffer
+	for _, st := range [][2]string{{"locks", "count"}, {"wait", "nanoseconds"}, {"hold", "nanoseconds"}} {
+		var vt protoBuffer
+		vt.int(valueTypeType, p.string(st[0]))
+		vt.int(valueTypeUnit, p.string(st[1]))
+		b.message(profileSampleType, &vt)
+	}
+	for _, key := range p.order {
+		s := p.samples[key]
+		var sb protoBuffer
+		sb.packedUint(sampleLocationID, s.locations)
+		sb.packedInt(sampleValue, s.values)
+		b.message(profileSamples, &sb)
+	}
+	for i, f := range p.locOrder {
+		var line protoBuffer
+		line.uint(lineFunctionID, p.functions[deadlog.Frame{Func: f.Func, File: f.File}])
+		line.int(lineLine, int64(f.Line))
+		var loc protoBuffer
+		loc.uint(locationID, uint64(i+1))
+		loc.message(locationLine, &line)
+		b.message(profileLocation, &loc)
+	}
+	for i, f := range p.funcOrder {
+		var fn protoBuffer
+		fn.uint(functionID, uint64(i+1))
+		fn.int(functionName, p.string(f.Func))
+		fn.int(functionSystemName, p.string(f.Func))
+		fn.int(functionFilename, p.string(f.File))
+		b.message(profileFunction, &fn)
+	}
+	b.int(profileTimeNanos, timeNanos)
+	b.int(profileDurationNanos, durationNanos)
+	b.int(profileDefaultSampleType, p.string("wait"))
+	// The string table goes last so that every string above is in it.
+	for _, s := range p.strings {
+		b.bytes(profileStringTable, []byte(s))
+	}
+	return b.Bytes()
+}
+
+// protoBuffer is a minimal protocol buffer encoder, enough for the pprof
+// format without depending on a protobuf library.
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protoBuffer) varint(v uint64) {
+	b.Write(binary.AppendUvarint(nil, v))
+}
+
+func (b *protoBuffer) key(field, wire int) {
+	b.varint(uint64(field)<<3 | uint64(wire))
+}
+
+// uint writes a varint field, omitting zero values like proto3 does.
+func (b *protoBuffer) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.varint(v)
+}
+
+func (b *protoBuffer) int(field int, v int64) {
+	b.uint(field, uint64(v))
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(data)))
+	b.Write(data)
+}
+
+func (b *protoBuffer) message(field int, m *protoBuffer) {
+	b.bytes(field, m.Bytes())
+}
+
+func (b *protoBuffer) packedUint(field int, vs []uint64) {
+	var p protoBuffer
+	for _, v := range vs {
+		p.varint(v)
+	}
+	b.bytes(field, p.Bytes())
+}
+
+func (b *protoBuffer) packedInt(field int, vs []int64) {
+	var p protoBuffer
+	for _, v := range vs {
+		p.varint(uint64(v))
+	}
+	b.bytes(field, p.Bytes())
+}
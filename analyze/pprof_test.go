@@ -0,0 +1,135 @@
+package analyze
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+// protoFields decodes the top-level fields of a protocol buffer message,
+// keeping varints as uint64 and length-delimited fields as []byte.
+func protoFields(t *testing.T, data []byte) map[int][]any {
+	t.Helper()
+	fields := make(map[int][]any)
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatal("bad field key")
+		}
+		data = data[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				t.Fatal("bad varint")
+			}
+			data = data[n:]
+			fields[field] = append(fields[field], v)
+		case wireBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || int(l) > len(data)-n {
+				t.Fatal("bad length")
+			}
+			fields[field] = append(fields[field], data[n:n+int(l)])
+			data = data[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func packedVarints(t *testing.T, data []byte) []uint64 {
+	t.Helper()
+	var vs []uint64
+	for len(data) > 0 {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatal("bad packed varint")
+		}
+		vs = append(vs, v)
+		data = data[n:]
+	}
+	return vs
+}
+
+func TestWritePprof(t *testing.T) {
+	input := `{"type":"LOCK","state":"START","name":"a","id":1,"trace":"update:25 <- main:12","ts":1000}
+{"type":"LOCK","state":"ACQUIRED","name":"a","id":1,"ts":3000}
+{"type":"LOCK","state":"RELEASED","name":"a","id":1,"ts":8000}
+{"type":"LOCK","state":"START","name":"a","id":2,"trace":"update:25 <- main:12","ts":8000}
+{"type":"LOCK","state":"ACQUIRED","name":"a","id":2,"ts":9000}
+{"type":"LOCK","state":"RELEASED","name":"a","id":2,"ts":10000}
+{"type":"LOCK","state":"START","name":"a","id":3,"trace":"other:7","ts":9000}
+`
+	spans, err := Spans(Events(strings.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WritePprof(&buf, spans); err != nil {
+		t.Fatalf("WritePprof error: %v", err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("output should be gzipped: %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := protoFields(t, data)
+	var strs []string
+	for _, s := range profile[profileStringTable] {
+		strs = append(strs, string(s.([]byte)))
+	}
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("string table must start with an empty string: %q", strs)
+	}
+	if len(profile[profileSampleType]) != 3 {
+		t.Fatalf("expected 3 sample types, got %d", len(profile[profileSampleType]))
+	}
+	if dst := profile[profileDefaultSampleType]; len(dst) != 1 || strs[dst[0].(uint64)] != "wait" {
+		t.Errorf("default sample type should be wait")
+	}
+
+	// Resolve each location to its function name.
+	funcNames := make(map[uint64]string)
+	for _, f := range profile[profileFunction] {
+		fn := protoFields(t, f.([]byte))
+		funcNames[fn[functionID][0].(uint64)] = strs[fn[functionName][0].(uint64)]
+	}
+	locFuncs := make(map[uint64]string)
+	for _, l := range profile[profileLocation] {
+		loc := protoFields(t, l.([]byte))
+		line := protoFields(t, loc[locationLine][0].([]byte))
+		locFuncs[loc[locationID][0].(uint64)] = funcNames[line[lineFunctionID][0].(uint64)]
+	}
+
+	samples := make(map[string][]uint64)
+	for _, s := range profile[profileSamples] {
+		sample := protoFields(t, s.([]byte))
+		var stack []string
+		for _, id := range packedVarints(t, sample[sampleLocationID][0].([]byte)) {
+			stack = append(stack, locFuncs[id])
+		}
+		samples[strings.Join(stack, ";")] = packedVarints(t, sample[sampleValue][0].([]byte))
+	}
+
+	// IDs 1 and 2 share a stack: 2 locks, 2000+1000 waited, 5000+1000 held.
+	if got := samples["a;update;main"]; len(got) != 3 || got[0] != 2 || got[1] != 3000 || got[2] != 6000 {
+		t.Errorf("unexpected values for shared stack: %v", got)
+	}
+	// ID 3 is still waiting at the last event.
+	if got := samples["a;other"]; len(got) != 3 || got[0] != 1 || got[1] != 1000 || got[2] != 0 {
+		t.Errorf("unexpected values for stuck stack: %v", got)
+	}
+	if len(samples) != 2 {
+		t.Errorf("expected 2 samples, got %v", samples)
+	}
+}
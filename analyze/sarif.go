@@ -0,0 +1,298 @@
+package analyze
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SARIF rule IDs for each kind of finding.
+const (
+	RuleStuck = "deadlog/stuck"
+	RuleHeld  = "deadlog/held"
+	RuleCycle = "deadlog/cycle"
+)
+
+// srcRootBaseID is the SARIF base ID that locations under a SourceRoot are
+// relative to; code scanning resolves it to the repository checkout.
+const srcRootBaseID = "%SRCROOT%"
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	FullDescription  sarifMessage `json:"fullDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifLogicalLocation struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// traceFrame is a single frame parsed from a legacy Trace string.
+type traceFrame struct {
+	Func string
+	Line int
+}
+
+// parseTrace splits a Trace string of the form "fn:line <- fn:line" into frames.
+// Frames that don't end in ":line" are kept with a zero line.
+func parseTrace(trace string) []traceFrame {
+	if trace == "" {
+		return nil
+	}
+	var frames []traceFrame
+	for _, part := range strings.Split(trace, " <- ") {
+		f := traceFrame{Func: part}
+		if idx := strings.LastIndex(part, ":"); idx != -1 {
+			if line, err := strconv.Atoi(part[idx+1:]); err == nil {
+				f.Func = part[:idx]
+				f.Line = line
+			}
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// SourceRoot maps the source files of stack frames to paths relative to the
+// root of a repository, so that code scanning can annotate them.
+type SourceRoot struct {
+	// Dir is the absolute directory the binary was built from, such as the
+	// repository checkout.
+	Dir string
+	// Module is the module path of Dir, for binaries built with -trimpath,
+	// whose frames carry paths like "example.com/mod/pkg/file.go".
+	Module string
+}
+
+var moduleLine = regexp.MustCompile(`(?m)^module\s+"?([^"\s]+)"?`)
+
+// NewSourceRoot returns the SourceRoot of a directory, reading its module
+// path from go.mod if it has one.
+func NewSourceRoot(dir string) (SourceRoot, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return SourceRoot{}, err
+	}
+	root := SourceRoot{Dir: dir}
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return SourceRoot{}, err
+	}
+	if m := moduleLine.FindSubmatch(data); m != nil {
+		root.Module = string(m[1])
+	}
+	return root, nil
+}
+
+// rel returns path relative to the root, in slash form, or false if it
+// isn't under it.
+func (s SourceRoot) rel(path string) (string, bool) {
+	path = filepath.ToSlash(path)
+	for _, prefix := range []string{filepath.ToSlash(s.Dir), s.Module} {
+		if prefix == "" {
+			continue
+		}
+		if rel, ok := strings.CutPrefix(path, prefix+"/"); ok {
+			return rel, true
+		}
+	}
+	return "", false
+}
+
+// artifact returns the location of a source file, relative to the root if
+// it is under it, and otherwise as an absolute file URI.
+func (s SourceRoot) artifact(path string) sarifArtifactLocation {
+	if rel, ok := s.rel(path); ok {
+		return sarifArtifactLocation{URI: rel, URIBaseID: srcRootBaseID}
+	}
+	return sarifArtifactLocation{URI: fileURI(path)}
+}
+
+// WriteSARIF writes the analysis results as a SARIF 2.1.0 log, with one result
+// per stuck or held lock and per lock order cycle. Locations are derived from
+// the lock's frames or trace, so findings are only attributed to source when
+// the mutex was created WithFrames or WithTrace. Only frames carry file paths,
+// so only they produce physical locations; those under root are relative to
+// the %SRCROOT% base ID, which code scanning maps to the repository. A zero
+// root leaves all paths absolute.
+func WriteSARIF(w io.Writer, r *Result, root SourceRoot) error {
+	results := []sarifResult{}
+	for _, info := range r.Stuck {
+		results = append(results, sarifResultFor(RuleStuck, "error", info, root,
+			"%s %s (ID: %d) started but never acquired"))
+	}
+	for _, info := range r.Held {
+		results = append(results, sarifResultFor(RuleHeld, "warning", info, root,
+			"%s %s (ID: %d) acquired but never released"))
+	}
+	for _, c := range r.Cycles {
+		results = append(results, sarifCycleResult(c, root))
+	}
+
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "deadlog",
+			InformationURI: "https://github.com/stevenctl/deadlog",
+			Rules: []sarifRule{
+				{
+					ID:               RuleStuck,
+					ShortDescription: sarifMessage{Text: "Lock started but never acquired"},
+					FullDescription:  sarifMessage{Text: "A goroutine logged START for a lock but never logged ACQUIRED, so it is waiting for the lock."},
+				},
+				{
+					ID:               RuleHeld,
+					ShortDescription: sarifMessage{Text: "Lock acquired but never released"},
+					FullDescription:  sarifMessage{Text: "A tracked lock logged ACQUIRED but never logged RELEASED, so it is still being held."},
+				},
+				{
+					ID:               RuleCycle,
+					ShortDescription: sarifMessage{Text: "Locks acquired in inconsistent order"},
+					FullDescription:  sarifMessage{Text: "Each lock of the cycle was taken while holding the previous one, so goroutines taking them concurrently can deadlock."},
+				},
+			},
+		}},
+		Results: results,
+	}
+	if root.Dir != "" {
+		run.OriginalURIBaseIDs = map[string]sarifArtifactLocation{
+			srcRootBaseID: {URI: fileURI(root.Dir) + "/"},
+		}
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+func sarifResultFor(rule, level string, info LockInfo, root SourceRoot, format string) sarifResult {
+	name := info.Name
+	if name == "" {
+		name = "(unnamed)"
+	}
+	res := sarifResult{
+		RuleID:  rule,
+		Level:   level,
+		Message: sarifMessage{Text: fmt.Sprintf(format, info.Type, name, info.ID)},
+	}
+	if loc, ok := sarifLocationFor(info, root); ok {
+		res.Locations = []sarifLocation{loc}
+		if loc.PhysicalLocation == nil {
+			res.Message.Text += fmt.Sprintf(" at %s", info.Trace)
+		}
+	}
+	return res
+}
+
+// sarifCycleResult returns the result of a lock order cycle, located at each
+// acquisition that took a lock while holding the previous one.
+func sarifCycleResult(c Cycle, root SourceRoot) sarifResult {
+	res := sarifResult{
+		RuleID:  RuleCycle,
+		Level:   "error",
+		Message: sarifMessage{Text: fmt.Sprintf("locks acquired in inconsistent order: %s", strings.Join(c.Names(), " -> "))},
+	}
+	for _, e := range c.Edges {
+		if loc, ok := sarifLocationFor(e.Wanted, root); ok {
+			res.Locations = append(res.Locations, loc)
+		}
+	}
+	return res
+}
+
+// sarifLocationFor returns the location of the code that called into the
+// mutex, the first frame of the operation's stack.
+func sarifLocationFor(info LockInfo, root SourceRoot) (sarifLocation, bool) {
+	if len(info.Frames) > 0 {
+		f := info.Frames[0]
+		return sarifLocation{
+			PhysicalLocation: &sarifPhysicalLocation{
+				ArtifactLocation: root.artifact(f.File),
+				Region:           &sarifRegion{StartLine: f.Line},
+			},
+			LogicalLocations: []sarifLogicalLocation{{Name: f.Func, Kind: "function"}},
+		}, true
+	}
+	if frames := parseTrace(info.Trace); len(frames) > 0 {
+		return sarifLocation{
+			LogicalLocations: []sarifLogicalLocation{{Name: frames[0].Func, Kind: "function"}},
+		}, true
+	}
+	return sarifLocation{}, false
+}
+
+// fileURI converts a source path from a stack frame to a URI.
+func fileURI(path string) string {
+	path = filepath.ToSlash(path)
+	if strings.HasPrefix(path, "/") {
+		return "file://" + path
+	}
+	return path
+}
@@ -0,0 +1,193 @@
+package analyze
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stevenctl/deadlog"
+)
+
+func TestParseTrace(t *testing.T) {
+	frames := parseTrace("updateHealth:25 <- main:10")
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got %d", len(frames))
+	}
+	if frames[0].Func != "updateHealth" || frames[0].Line != 25 {
+		t.Errorf("unexpected first frame: %+v", frames[0])
+	}
+	if frames[1].Func != "main" || frames[1].Line != 10 {
+		t.Errorf("unexpected second frame: %+v", frames[1])
+	}
+	if frames := parseTrace(""); frames != nil {
+		t.Errorf("expected no frames for empty trace, got %v", frames)
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	result := &Result{
+		Stuck: []LockInfo{
+			{Type: "LOCK", Name: "apply-damage", ID: 1, Trace: "applyDamage:33"},
+		},
+		Held: []LockInfo{
+			{Type: "LOCK", Name: "update-health", ID: 2, Trace: "updateHealth:25 <- main:10"},
+			{Type: "RLOCK", Name: "no-trace", ID: 3},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, result, SourceRoot{}); err != nil {
+		t.Fatalf("WriteSARIF error: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	if log.Version != "2.1.0" {
+		t.Errorf("expected version 2.1.0, got %q", log.Version)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(log.Runs))
+	}
+
+	results := log.Runs[0].Results
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if results[0].RuleID != RuleStuck || results[0].Level != "error" {
+		t.Errorf("expected stuck error result, got %s %s", results[0].RuleID, results[0].Level)
+	}
+	if results[1].RuleID != RuleHeld || results[1].Level != "warning" {
+		t.Errorf("expected held warning result, got %s %s", results[1].RuleID, results[1].Level)
+	}
+	if len(results[1].Locations) != 1 || results[1].Locations[0].LogicalLocations[0].Name != "updateHealth" {
+		t.Errorf("expected location in updateHealth, got %+v", results[1].Locations)
+	}
+	if len(results[2].Locations) != 0 {
+		t.Errorf("expected no locations without a trace, got %+v", results[2].Locations)
+	}
+}
+
+func TestWriteSARIF_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, &Result{}, SourceRoot{}); err != nil {
+		t.Fatalf("WriteSARIF error: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	// Code scanning expects an empty array rather than null.
+	if log.Runs[0].Results == nil {
+		t.Error("expected empty results array")
+	}
+}
+
+func TestWriteSARIF_Frames(t *testing.T) {
+	result := &Result{
+		Held: []LockInfo{{
+			Type: "LOCK", Name: "store", ID: 1, Trace: "Update:25",
+			Frames: []deadlog.Frame{{Func: "example.com/pkg.(*Store).Update", File: "/src/pkg/store.go", Line: 25}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, result, SourceRoot{}); err != nil {
+		t.Fatalf("WriteSARIF error: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	loc := log.Runs[0].Results[0].Locations[0]
+	if loc.PhysicalLocation == nil {
+		t.Fatal("expected a physical location from frames")
+	}
+	if loc.PhysicalLocation.ArtifactLocation.URI != "file:///src/pkg/store.go" {
+		t.Errorf("unexpected URI %q", loc.PhysicalLocation.ArtifactLocation.URI)
+	}
+	if loc.PhysicalLocation.Region.StartLine != 25 {
+		t.Errorf("expected start line 25, got %d", loc.PhysicalLocation.Region.StartLine)
+	}
+	if loc.LogicalLocations[0].Name != "example.com/pkg.(*Store).Update" {
+		t.Errorf("expected fully-qualified logical location, got %q", loc.LogicalLocations[0].Name)
+	}
+}
+
+func TestWriteSARIF_SourceRoot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n\ngo 1.25\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	root, err := NewSourceRoot(dir)
+	if err != nil {
+		t.Fatalf("NewSourceRoot error: %v", err)
+	}
+	if root.Module != "example.com/app" {
+		t.Errorf("expected module example.com/app, got %q", root.Module)
+	}
+
+	result := &Result{
+		Held: []LockInfo{
+			{Type: "LOCK", ID: 1, Frames: []deadlog.Frame{{Func: "f", File: filepath.Join(dir, "pkg", "store.go"), Line: 25}}},
+			{Type: "LOCK", ID: 2, Frames: []deadlog.Frame{{Func: "g", File: "example.com/app/main.go", Line: 7}}},
+			{Type: "LOCK", ID: 3, Frames: []deadlog.Frame{{Func: "sync.f", File: "/usr/local/go/src/sync/mutex.go", Line: 9}}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, result, root); err != nil {
+		t.Fatalf("WriteSARIF error: %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+
+	want := []sarifArtifactLocation{
+		{URI: "pkg/store.go", URIBaseID: "%SRCROOT%"},
+		{URI: "main.go", URIBaseID: "%SRCROOT%"},
+		{URI: "file:///usr/local/go/src/sync/mutex.go"},
+	}
+	for i, res := range log.Runs[0].Results {
+		if got := res.Locations[0].PhysicalLocation.ArtifactLocation; got != want[i] {
+			t.Errorf("result %d: expected %+v, got %+v", i, want[i], got)
+		}
+	}
+	base, ok := log.Runs[0].OriginalURIBaseIDs["%SRCROOT%"]
+	if !ok || !strings.HasSuffix(base.URI, "/") {
+		t.Errorf("expected a %%SRCROOT%% base URI ending in /, got %+v", log.Runs[0].OriginalURIBaseIDs)
+	}
+}
+
+func TestWriteSARIF_Cycle(t *testing.T) {
+	result := &Result{
+		Cycles: []Cycle{{Edges: []LockOrder{
+			{Held: LockInfo{Name: "a"}, Wanted: LockInfo{Name: "b", Frames: []deadlog.Frame{{Func: "f", File: "/src/f.go", Line: 1}}}},
+			{Held: LockInfo{Name: "b"}, Wanted: LockInfo{Name: "a", Frames: []deadlog.Frame{{Func: "g", File: "/src/g.go", Line: 2}}}},
+		}}},
+	}
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, result, SourceRoot{Dir: "/src"}); err != nil {
+		t.Fatalf("WriteSARIF error: %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	res := log.Runs[0].Results
+	if len(res) != 1 || res[0].RuleID != RuleCycle {
+		t.Fatalf("expected one cycle result, got %+v", res)
+	}
+	if !strings.Contains(res[0].Message.Text, "a -> b -> a") {
+		t.Errorf("unexpected message %q", res[0].Message.Text)
+	}
+	if len(res[0].Locations) != 2 || res[0].Locations[1].PhysicalLocation.ArtifactLocation.URI != "g.go" {
+		t.Errorf("expected a location per edge, got %+v", res[0].Locations)
+	}
+}
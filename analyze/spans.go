@@ -0,0 +1,102 @@
+package analyze
+
+import (
+	"errors"
+	"iter"
+	"sort"
+
+	"github.com/stevenctl/deadlog"
+)
+
+// Span is the full lifecycle of one lock operation, for timelines and
+// profiles. Timestamps are unix nanoseconds and zero when the event wasn't
+// seen: Acquired is zero for a lock still waiting, Released is zero for a
+// lock still held or an untracked lock.
+type Span struct {
+	Type      string
+	Name      string
+	ID        int
+	Goroutine int64 // ID of the goroutine if logged, see deadlog.WithGoroutineID
+	Trace     string
+	Frames    []deadlog.Frame
+	Start     int64
+	Acquired  int64
+	Released  int64
+}
+
+// Wait returns the time spent waiting to acquire the lock in nanoseconds,
+// or 0 if it was never acquired.
+func (s Span) Wait() int64 {
+	if s.Start == 0 || s.Acquired == 0 {
+		return 0
+	}
+	return s.Acquired - s.Start
+}
+
+// Hold returns the time the lock was held in nanoseconds, or 0 if it was
+// never released.
+func (s Span) Hold() int64 {
+	if s.Acquired == 0 || s.Released == 0 {
+		return 0
+	}
+	return s.Released - s.Acquired
+}
+
+// Spans pairs the events of each operation into spans, sorted by the time
+// the operation started. Unlike Tracker, it keeps every operation in memory.
+// A *LineError is skipped; any other error aborts.
+func Spans(events iter.Seq2[deadlog.Event, error]) ([]Span, error) {
+	index := make(map[opKey]int)
+	var spans []Span
+
+	for e, err := range events {
+		if err != nil {
+			var lineErr *LineError
+			if errors.As(err, &lineErr) {
+				continue
+			}
+			return nil, err
+		}
+		if e.State == "" {
+			continue
+		}
+
+		key := opKey{process: processOf(e), Type: e.Type, Name: e.Name, ID: e.ID}
+		i, ok := index[key]
+		if !ok {
+			i = len(spans)
+			index[key] = i
+			spans = append(spans, Span{Type: e.Type, Name: e.Name, ID: e.ID})
+		}
+		s := &spans[i]
+		if s.Trace == "" && len(s.Frames) == 0 {
+			s.Trace, s.Frames = e.Trace, e.Frames
+		}
+		if s.Goroutine == 0 {
+			s.Goroutine = e.Goroutine
+		}
+		switch e.State {
+		case "START":
+			s.Start = e.Ts
+		case "ACQUIRED":
+			s.Acquired = e.Ts
+		case "RELEASED":
+			s.Released = e.Ts
+		}
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].begin() < spans[j].begin()
+	})
+	return spans, nil
+}
+
+// begin returns the earliest timestamp seen for the span.
+func (s Span) begin() int64 {
+	for _, ts := range []int64{s.Start, s.Acquired, s.Released} {
+		if ts != 0 {
+			return ts
+		}
+	}
+	return 0
+}
@@ -0,0 +1,41 @@
+package analyze
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpans(t *testing.T) {
+	input := `{"type":"LOCK","state":"START","name":"a","id":1,"trace":"f:1","ts":100}
+{"type":"LOCK","state":"ACQUIRED","name":"a","id":1,"trace":"f:1","ts":150}
+{"type":"WLOCK","state":"START","name":"b","id":2,"ts":120}
+{"type":"LOCK","state":"START","name":"a","id":3,"ts":160}
+{"type":"LOCK","state":"RELEASED","name":"a","id":1,"trace":"g:2","ts":400}
+{"type":"WLOCK","state":"ACQUIRED","name":"b","id":2,"ts":130}
+`
+	spans, err := Spans(Events(strings.NewReader(input)))
+	if err != nil {
+		t.Fatalf("Spans error: %v", err)
+	}
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+
+	a := spans[0]
+	if a.ID != 1 || a.Start != 100 || a.Acquired != 150 || a.Released != 400 {
+		t.Errorf("unexpected span: %+v", a)
+	}
+	if a.Wait() != 50 || a.Hold() != 250 {
+		t.Errorf("expected wait 50 and hold 250, got %d and %d", a.Wait(), a.Hold())
+	}
+	if a.Trace != "f:1" {
+		t.Errorf("expected the acquisition trace, got %q", a.Trace)
+	}
+
+	if spans[1].ID != 2 || spans[1].Hold() != 0 {
+		t.Errorf("expected untracked span 2 without a hold, got %+v", spans[1])
+	}
+	if spans[2].ID != 3 || spans[2].Acquired != 0 || spans[2].Wait() != 0 {
+		t.Errorf("expected stuck span 3, got %+v", spans[2])
+	}
+}
@@ -0,0 +1,77 @@
+package analyze
+
+import (
+	"sort"
+	"time"
+)
+
+// NameStats summarizes the outstanding operations on one lock name.
+type NameStats struct {
+	Name    string
+	Waiters int           // operations waiting to acquire
+	Holders int           // tracked operations holding the lock
+	MaxWait time.Duration // longest current wait
+	MaxHold time.Duration // longest current hold
+}
+
+// Summarize aggregates the stuck and held locks of r per name, as of now.
+// Stats are sorted by waiters, then longest wait, then longest hold.
+func Summarize(r *Result, now time.Time) []NameStats {
+	stats := make(map[string]*NameStats)
+	get := func(name string) *NameStats {
+		s, ok := stats[name]
+		if !ok {
+			s = &NameStats{Name: name}
+			stats[name] = s
+		}
+		return s
+	}
+	for _, info := range r.Stuck {
+		s := get(info.Name)
+		s.Waiters++
+		s.MaxWait = max(s.MaxWait, now.Sub(time.Unix(0, info.Ts)))
+	}
+	for _, info := range r.Held {
+		s := get(info.Name)
+		s.Holders++
+		s.MaxHold = max(s.MaxHold, now.Sub(time.Unix(0, info.Ts)))
+	}
+
+	out := make([]NameStats, 0, len(stats))
+	for _, s := range stats {
+		out = append(out, *s)
+	}
+	SortStats(out, SortByWaiters)
+	return out
+}
+
+// Orderings for SortStats.
+const (
+	SortByWaiters = "waiters"
+	SortByWait    = "wait"
+	SortByHold    = "hold"
+)
+
+// SortStats sorts stats by the given ordering, largest first, breaking ties
+// by the other orderings and then by name.
+func SortStats(stats []NameStats, by string) {
+	keys := func(s NameStats) [3]int64 {
+		switch by {
+		case SortByWait:
+			return [3]int64{int64(s.MaxWait), int64(s.Waiters), int64(s.MaxHold)}
+		case SortByHold:
+			return [3]int64{int64(s.MaxHold), int64(s.Waiters), int64(s.MaxWait)}
+		default:
+			return [3]int64{int64(s.Waiters), int64(s.MaxWait), int64(s.MaxHold)}
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		ki, kj := keys(stats[i]), keys(stats[j])
+		for k := range ki {
+			if ki[k] != kj[k] {
+				return ki[k] > kj[k]
+			}
+		}
+		return stats[i].Name < stats[j].Name
+	})
+}
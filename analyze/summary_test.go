@@ -0,0 +1,51 @@
+package analyze
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	now := time.Unix(100, 0)
+	ago := func(d time.Duration) int64 { return now.Add(-d).UnixNano() }
+
+	result := &Result{
+		Stuck: []LockInfo{
+			{Type: "LOCK", Name: "a", ID: 1, Ts: ago(time.Second)},
+			{Type: "LOCK", Name: "a", ID: 2, Ts: ago(3 * time.Second)},
+			{Type: "LOCK", Name: "b", ID: 3, Ts: ago(10 * time.Second)},
+		},
+		Held: []LockInfo{
+			{Type: "LOCK", Name: "a", ID: 4, Ts: ago(5 * time.Second)},
+			{Type: "RLOCK", Name: "c", ID: 5, Ts: ago(20 * time.Second)},
+		},
+	}
+
+	stats := Summarize(result, now)
+	if len(stats) != 3 {
+		t.Fatalf("expected 3 names, got %d", len(stats))
+	}
+	a := stats[0]
+	if a.Name != "a" || a.Waiters != 2 || a.Holders != 1 || a.MaxWait != 3*time.Second || a.MaxHold != 5*time.Second {
+		t.Errorf("unexpected stats for a: %+v", a)
+	}
+
+	order := func(stats []NameStats) string {
+		var s string
+		for _, st := range stats {
+			s += st.Name
+		}
+		return s
+	}
+	if got := order(stats); got != "abc" {
+		t.Errorf("expected sort by waiters abc, got %s", got)
+	}
+	SortStats(stats, SortByWait)
+	if got := order(stats); got != "bac" {
+		t.Errorf("expected sort by wait bac, got %s", got)
+	}
+	SortStats(stats, SortByHold)
+	if got := order(stats); got != "cab" {
+		t.Errorf("expected sort by hold cab, got %s", got)
+	}
+}
@@ -0,0 +1,96 @@
+package analyze
+
+import (
+	"debug/elf"
+	"debug/gosym"
+	"errors"
+	"fmt"
+
+	"github.com/stevenctl/deadlog"
+)
+
+// Symbolizer resolves program counters logged WithPCs into frames, using the
+// symbol table of the ELF binary that produced them.
+//
+// Inlined calls are attributed to the function they were inlined into.
+// Position-independent executables are not supported, since the address they
+// were loaded at isn't logged; NewSymbolizer rejects them rather than
+// resolving PCs to the wrong frames.
+type Symbolizer struct {
+	table   *gosym.Table
+	buildID string
+}
+
+// NewSymbolizer loads the Go symbol table from the ELF binary at path.
+func NewSymbolizer(path string) (*Symbolizer, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if f.Type == elf.ET_DYN {
+		return nil, errors.New("binary is position-independent, so its logged PCs can't be resolved; build it with -buildmode=exe")
+	}
+	pclntab := f.Section(".gopclntab")
+	text := f.Section(".text")
+	if pclntab == nil || text == nil {
+		return nil, errors.New("binary has no Go symbol table")
+	}
+	data, err := pclntab.Data()
+	if err != nil {
+		return nil, err
+	}
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr))
+	if err != nil {
+		return nil, fmt.Errorf("reading symbol table: %w", err)
+	}
+
+	buildID, _ := deadlog.ReadBuildID(path)
+	return &Symbolizer{table: table, buildID: buildID}, nil
+}
+
+// BuildID returns the Go build ID of the binary, or "" if it has none.
+func (s *Symbolizer) BuildID() string {
+	return s.buildID
+}
+
+// Frames resolves pcs to frames, innermost first. Unknown PCs are skipped.
+func (s *Symbolizer) Frames(pcs []uintptr) []deadlog.Frame {
+	frames := make([]deadlog.Frame, 0, len(pcs))
+	for _, pc := range pcs {
+		// Logged PCs are return addresses; back up into the call instruction.
+		file, line, fn := s.table.PCToLine(uint64(pc) - 1)
+		if fn == nil {
+			continue
+		}
+		frames = append(frames, deadlog.Frame{Func: fn.Name, File: file, Line: line})
+	}
+	return frames
+}
+
+// Symbolize fills in the Frames of every stuck and held lock that was logged
+// with PCs but no frames. It returns an error if any lock was logged by a
+// binary with a different build ID, in which case those locks are left as-is.
+func (s *Symbolizer) Symbolize(r *Result) error {
+	var mismatched int
+	symbolize := func(infos []LockInfo) {
+		for i := range infos {
+			info := &infos[i]
+			if len(info.PCs) == 0 || len(info.Frames) > 0 {
+				continue
+			}
+			if info.BuildID != "" && s.buildID != "" && info.BuildID != s.buildID {
+				mismatched++
+				continue
+			}
+			info.Frames = s.Frames(info.PCs)
+		}
+	}
+	symbolize(r.Stuck)
+	symbolize(r.Held)
+	if mismatched > 0 {
+		return fmt.Errorf("%d locks were logged by a different binary than %s", mismatched, s.buildID)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package analyze
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stevenctl/deadlog"
+)
+
+func newTestSymbolizer(t *testing.T) *Symbolizer {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("symbolization requires an ELF binary")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSymbolizer(exe)
+	if err != nil {
+		t.Fatalf("NewSymbolizer error: %v", err)
+	}
+	return s
+}
+
+func TestSymbolizer_Symbolize(t *testing.T) {
+	s := newTestSymbolizer(t)
+
+	var buf bytes.Buffer
+	m := deadlog.New(
+		deadlog.WithName("pcs-test"),
+		deadlog.WithPCs(3),
+		deadlog.WithLogger(deadlog.WriterLogger(&buf)),
+	)
+	_ = m.LockFunc() // ignore unlock function
+
+	result, err := Analyze(&buf)
+	if err != nil {
+		t.Fatalf("Analyze error: %v", err)
+	}
+	if len(result.Held) != 1 {
+		t.Fatalf("expected 1 held lock, got %d", len(result.Held))
+	}
+	if len(result.Held[0].PCs) == 0 {
+		t.Fatal("expected PCs to be present")
+	}
+	if result.Held[0].BuildID != s.BuildID() {
+		t.Errorf("expected build ID %q, got %q", s.BuildID(), result.Held[0].BuildID)
+	}
+
+	if err := s.Symbolize(result); err != nil {
+		t.Fatalf("Symbolize error: %v", err)
+	}
+	frames := result.Held[0].Frames
+	if len(frames) == 0 {
+		t.Fatal("expected frames after symbolizing")
+	}
+	if frames[0].Func != "github.com/stevenctl/deadlog/analyze.TestSymbolizer_Symbolize" {
+		t.Errorf("expected the test function, got %q", frames[0].Func)
+	}
+	if frames[0].Line == 0 || frames[0].File == "" {
+		t.Errorf("expected file and line, got %+v", frames[0])
+	}
+
+	m.Unlock()
+}
+
+func TestSymbolizer_BuildIDMismatch(t *testing.T) {
+	s := newTestSymbolizer(t)
+
+	var pcs [1]uintptr
+	runtime.Callers(1, pcs[:])
+	result := &Result{
+		Held: []LockInfo{{Type: "LOCK", Name: "other", ID: 1, PCs: pcs[:], BuildID: "some-other-binary"}},
+	}
+
+	if err := s.Symbolize(result); err == nil {
+		t.Error("expected an error for a mismatched build ID")
+	}
+	if len(result.Held[0].Frames) != 0 {
+		t.Error("locks from another binary should not be symbolized")
+	}
+}
+
+func TestNewSymbolizer_PIE(t *testing.T) {
+	// A bare ELF header is enough to tell a position-independent executable.
+	hdr := elf.Header64{
+		Type:    uint16(elf.ET_DYN),
+		Machine: uint16(elf.EM_X86_64),
+		Version: uint32(elf.EV_CURRENT),
+		Ehsize:  uint16(binary.Size(elf.Header64{})),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, hdr); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "pie")
+	if err := os.WriteFile(path, buf.Bytes(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewSymbolizer(path)
+	if err == nil || !strings.Contains(err.Error(), "position-independent") {
+		t.Errorf("expected a position-independent executable to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,341 @@
+package analyze
+
+import (
+	"cmp"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stevenctl/deadlog"
+)
+
+// process identifies the process that logged an event: its source and, for
+// go test -json input, where each package runs its own test binary, the
+// package.
+type process struct {
+	source, pkg string
+}
+
+// processOf returns the process that logged e.
+func processOf(e deadlog.Event) process {
+	return process{e.Source, e.Package}
+}
+
+// compareProcesses orders processes by source and then package.
+func compareProcesses(a, b process) int {
+	return cmp.Or(strings.Compare(a.source, b.source), strings.Compare(a.pkg, b.pkg))
+}
+
+// opKey identifies a single lock operation. IDs are only unique within a
+// process, so the key includes the process that logged the event.
+type opKey struct {
+	process
+	Type string
+	Name string
+	ID   int
+}
+
+// nameKey identifies a lock name within a process.
+type nameKey struct {
+	process
+	Name string
+}
+
+// Tracker pairs lock events incrementally. It only keeps operations that are
+// still outstanding: a START is dropped once its ACQUIRED is observed, and a
+// tracked ACQUIRED once its RELEASED is observed, so memory stays bounded by
+// the number of concurrent operations rather than the length of the log.
+//
+// Tracker is safe for concurrent use. Its Observe method can be passed to
+// deadlog.WithLogger to track locks inside a live process.
+type Tracker struct {
+	mu        sync.Mutex
+	starts    map[opKey]LockInfo     // started but not yet acquired
+	acquires  map[opKey]LockInfo     // tracked and acquired but not yet released
+	untracked map[nameKey]LockInfo   // last untracked ACQUIRED per name
+	order     map[orderKey]LockOrder // first observation of each lock order
+
+	sessions []Session       // sessions in order of their first header
+	current  map[process]int // index of the current session per process
+}
+
+// NewTracker creates an empty Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{
+		starts:    make(map[opKey]LockInfo),
+		acquires:  make(map[opKey]LockInfo),
+		untracked: make(map[nameKey]LockInfo),
+		order:     make(map[orderKey]LockOrder),
+		current:   make(map[process]int),
+	}
+}
+
+// Observe records a single event. Events of one operation must be observed
+// in order. TRACE definitions are ignored; resolve them with ResolveTraces
+// first when reading logs written through deadlog.InternTraces.
+//
+// Sessions are kept per Source and, for go test -json input, per Package. A
+// HEADER event from a different process than the previous header of the
+// same source and package means the process restarted: the operations
+// outstanding until then are moved to an ended Session instead of being
+// reported as stuck or held forever. So are those logged before the first
+// header, which came from an earlier process that didn't log one.
+func (t *Tracker) Observe(e deadlog.Event) {
+	p := processOf(e)
+	key := opKey{process: p, Type: e.Type, Name: e.Name, ID: e.ID}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e.Type == "HEADER" && e.Header != nil {
+		t.observeHeader(p, e.Header)
+		return
+	}
+
+	switch e.State {
+	case "START":
+		info := newLockInfo(e)
+		t.observeOrder(info)
+		t.starts[key] = info
+	case "ACQUIRED":
+		delete(t.starts, key)
+		// WLOCK/RWLOCK don't track RELEASED, so there's nothing to wait for.
+		// Only the latest one per name is kept as a possible blocker.
+		if isTrackedType(e.Type) {
+			t.acquires[key] = newLockInfo(e)
+		} else {
+			t.untracked[nameKey{p, e.Name}] = newLockInfo(e)
+		}
+	case "RELEASED":
+		delete(t.acquires, key)
+	}
+}
+
+// Session is one run of a process in a log, starting at its HEADER event.
+type Session struct {
+	Source  string          // source of the log, see WithSource
+	Package string          // package of the test binary, for go test -json input
+	Header  *deadlog.Header // the process that wrote the session, nil for events before the first header
+	Ended   bool            // a later header showed that the process restarted
+
+	// Stuck and Held are the operations outstanding when an ended session
+	// was replaced. Those of current sessions are in Result.Stuck and
+	// Result.Held.
+	Stuck []LockInfo
+	Held  []LockInfo
+}
+
+// observeHeader starts a new session for p if h is from a different process
+// than its current session. t.mu must be held.
+func (t *Tracker) observeHeader(p process, h *deadlog.Header) {
+	if i, ok := t.current[p]; ok {
+		cur := &t.sessions[i]
+		if cur.Header.SameProcess(h) {
+			return
+		}
+		cur.Ended = true
+		cur.Stuck, cur.Held = t.take(p)
+	} else if stuck, held := t.take(p); len(stuck)+len(held) > 0 {
+		t.sessions = append(t.sessions, Session{Source: p.source, Package: p.pkg, Ended: true, Stuck: stuck, Held: held})
+	}
+	t.current[p] = len(t.sessions)
+	t.sessions = append(t.sessions, Session{Source: p.source, Package: p.pkg, Header: h})
+}
+
+// take removes and returns the outstanding operations of p.
+// t.mu must be held.
+func (t *Tracker) take(p process) (stuck, held []LockInfo) {
+	for key, info := range t.starts {
+		if key.process == p {
+			stuck = append(stuck, info)
+			delete(t.starts, key)
+		}
+	}
+	for key, info := range t.acquires {
+		if key.process == p {
+			held = append(held, info)
+			delete(t.acquires, key)
+		}
+	}
+	for key := range t.untracked {
+		if key.process == p {
+			delete(t.untracked, key)
+		}
+	}
+	sortLocks(stuck)
+	sortLocks(held)
+	return stuck, held
+}
+
+// Result returns the currently stuck and held locks, the sessions seen and
+// the lock order cycles observed so far.
+func (t *Tracker) Result() *Result {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := &Result{Sessions: slices.Clone(t.sessions), Cycles: t.cycles()}
+	for _, info := range t.starts {
+		result.Stuck = append(result.Stuck, info)
+	}
+	for _, info := range t.acquires {
+		result.Held = append(result.Held, info)
+	}
+
+	// Sort for deterministic output
+	sortLocks(result.Stuck)
+	sortLocks(result.Held)
+	return result
+}
+
+// sortLocks sorts locks by source and then ID.
+func sortLocks(infos []LockInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Source != infos[j].Source {
+			return infos[i].Source < infos[j].Source
+		}
+		return infos[i].ID < infos[j].ID
+	})
+}
+
+// event converts a LockInfo back to an event in the given state.
+func (info LockInfo) event(state string) deadlog.Event {
+	return deadlog.Event{
+		Type:    info.Type,
+		State:   state,
+		Name:    info.Name,
+		ID:      info.ID,
+		Trace:   info.Trace,
+		Ts:      info.Ts,
+		Frames:  info.Frames,
+		PCs:     info.PCs,
+		BuildID: info.BuildID,
+		Source:  info.Source,
+		Prefix:  info.Prefix,
+		Package: info.Package,
+		Test:    info.Test,
+
+		Goroutine: info.Goroutine,
+	}
+}
+
+func newLockInfo(e deadlog.Event) LockInfo {
+	return LockInfo{
+		Type:    e.Type,
+		Name:    e.Name,
+		ID:      e.ID,
+		Trace:   e.Trace,
+		Frames:  e.Frames,
+		PCs:     e.PCs,
+		BuildID: e.BuildID,
+		Ts:      e.Ts,
+		Source:  e.Source,
+		Prefix:  e.Prefix,
+		Package: e.Package,
+		Test:    e.Test,
+
+		Goroutine: e.Goroutine,
+	}
+}
+
+// WriteEvents writes the outstanding operations as deadlog JSON events, so
+// the snapshot can be read back with Analyze or Events. Stuck locks are
+// written as a START, held locks as a START and an ACQUIRED.
+func (t *Tracker) WriteEvents(w io.Writer) error {
+	r := t.Result()
+	enc := json.NewEncoder(w)
+	for _, info := range r.Stuck {
+		if err := enc.Encode(info.event("START")); err != nil {
+			return err
+		}
+	}
+	for _, info := range r.Held {
+		if err := enc.Encode(info.event("START")); err != nil {
+			return err
+		}
+		if err := enc.Encode(info.event("ACQUIRED")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves a snapshot of the outstanding operations as written by
+// WriteEvents, so a Tracker running in a process can be mounted as a debug
+// endpoint and read by deadlog top or deadlog analyze.
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	_ = t.WriteEvents(w)
+}
+
+// Alert kinds reported by Tracker.Overdue.
+const (
+	AlertWait = "WAIT" // a lock has been waiting too long to be acquired
+	AlertHold = "HOLD" // a tracked lock has been held too long
+)
+
+// Alert reports an outstanding lock operation that exceeded a threshold.
+type Alert struct {
+	Kind     string        // AlertWait or AlertHold
+	Lock     LockInfo      // the overdue operation
+	Duration time.Duration // how long it has been waiting or held
+
+	// Blockers are the locks with the same name that were acquired but not
+	// released when a WAIT alert fired: held tracked locks, and the last
+	// untracked one, which may have been released already.
+	Blockers []LockInfo
+}
+
+// Overdue returns an alert for every operation that, as of now, has been
+// waiting longer than wait or held longer than hold. A zero threshold
+// disables that kind of alert. Alerts are sorted by duration, longest first.
+func (t *Tracker) Overdue(now time.Time, wait, hold time.Duration) []Alert {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var alerts []Alert
+	if wait > 0 {
+		for _, info := range t.starts {
+			if d := now.Sub(time.Unix(0, info.Ts)); d > wait {
+				alerts = append(alerts, Alert{Kind: AlertWait, Lock: info, Duration: d, Blockers: t.blockers(info)})
+			}
+		}
+	}
+	if hold > 0 {
+		for _, info := range t.acquires {
+			if d := now.Sub(time.Unix(0, info.Ts)); d > hold {
+				alerts = append(alerts, Alert{Kind: AlertHold, Lock: info, Duration: d})
+			}
+		}
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Duration != alerts[j].Duration {
+			return alerts[i].Duration > alerts[j].Duration
+		}
+		return alerts[i].Lock.ID < alerts[j].Lock.ID
+	})
+	return alerts
+}
+
+// blockers returns the locks in the same process that may be blocking a
+// waiter. t.mu must be held.
+func (t *Tracker) blockers(waiter LockInfo) []LockInfo {
+	var out []LockInfo
+	for _, info := range t.acquires {
+		if info.Name == waiter.Name && info.Source == waiter.Source && info.Package == waiter.Package {
+			out = append(out, info)
+		}
+	}
+	if info, ok := t.untracked[nameKey{process{waiter.Source, waiter.Package}, waiter.Name}]; ok {
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Ts < out[j].Ts
+	})
+	return out
+}
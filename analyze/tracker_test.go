@@ -0,0 +1,359 @@
+package analyze
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stevenctl/deadlog"
+)
+
+func TestTracker_PrunesCompletedOperations(t *testing.T) {
+	tracker := NewTracker()
+	m := deadlog.New(deadlog.WithName("pruned"), deadlog.WithLogger(tracker.Observe))
+
+	for i := 0; i < 1000; i++ {
+		unlock := m.LockFunc()
+		unlock()
+		m.Lock()
+		m.Unlock()
+	}
+
+	if n := len(tracker.starts) + len(tracker.acquires); n != 0 {
+		t.Errorf("expected completed operations to be pruned, %d entries remain", n)
+	}
+	result := tracker.Result()
+	if len(result.Stuck) != 0 || len(result.Held) != 0 {
+		t.Errorf("expected no issues, got %d stuck and %d held", len(result.Stuck), len(result.Held))
+	}
+}
+
+func TestTracker_Live(t *testing.T) {
+	tracker := NewTracker()
+	m := deadlog.New(deadlog.WithName("live"), deadlog.WithLogger(tracker.Observe))
+
+	unlock := m.LockFunc()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.RLock()
+		m.RUnlock()
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	result := tracker.Result()
+	if len(result.Held) != 1 || result.Held[0].Type != "LOCK" {
+		t.Errorf("expected the LOCK to be held, got %+v", result.Held)
+	}
+	if len(result.Stuck) != 1 || result.Stuck[0].Type != "RWLOCK" {
+		t.Errorf("expected the RWLOCK to be stuck, got %+v", result.Stuck)
+	}
+
+	unlock()
+	<-done
+
+	result = tracker.Result()
+	if len(result.Stuck) != 0 || len(result.Held) != 0 {
+		t.Errorf("expected no issues after release, got %d stuck and %d held", len(result.Stuck), len(result.Held))
+	}
+}
+
+func TestTracker_Concurrent(t *testing.T) {
+	tracker := NewTracker()
+	m := deadlog.New(deadlog.WithName("concurrent"), deadlog.WithLogger(tracker.Observe))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				unlock := m.RLockFunc()
+				_ = tracker.Result()
+				unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	result := tracker.Result()
+	if len(result.Stuck) != 0 || len(result.Held) != 0 {
+		t.Errorf("expected no issues, got %d stuck and %d held", len(result.Stuck), len(result.Held))
+	}
+}
+
+func TestTracker_Overdue(t *testing.T) {
+	base := time.Unix(1000, 0)
+	ts := func(d time.Duration) int64 { return base.Add(d).UnixNano() }
+
+	tracker := NewTracker()
+	events := []deadlog.Event{
+		// Untracked lock on "a", acquired first and never released.
+		{Type: "WLOCK", State: "START", Name: "a", ID: 1, Ts: ts(0)},
+		{Type: "WLOCK", State: "ACQUIRED", Name: "a", ID: 1, Ts: ts(0)},
+		// Tracked lock on "b", held for a long time.
+		{Type: "LOCK", State: "START", Name: "b", ID: 2, Ts: ts(time.Second)},
+		{Type: "LOCK", State: "ACQUIRED", Name: "b", ID: 2, Ts: ts(time.Second)},
+		// Waiters on both.
+		{Type: "WLOCK", State: "START", Name: "a", ID: 3, Ts: ts(2 * time.Second)},
+		{Type: "LOCK", State: "START", Name: "b", ID: 4, Ts: ts(9 * time.Second)},
+	}
+	for _, e := range events {
+		tracker.Observe(e)
+	}
+
+	alerts := tracker.Overdue(base.Add(10*time.Second), 5*time.Second, 8*time.Second)
+	if len(alerts) != 2 {
+		t.Fatalf("expected 2 alerts, got %d: %+v", len(alerts), alerts)
+	}
+
+	hold := alerts[0]
+	if hold.Kind != AlertHold || hold.Lock.ID != 2 || hold.Duration != 9*time.Second {
+		t.Errorf("expected HOLD on ID 2 for 9s first, got %s on %d for %s", hold.Kind, hold.Lock.ID, hold.Duration)
+	}
+
+	wait := alerts[1]
+	if wait.Kind != AlertWait || wait.Lock.ID != 3 || wait.Duration != 8*time.Second {
+		t.Errorf("expected WAIT on ID 3 for 8s, got %s on %d for %s", wait.Kind, wait.Lock.ID, wait.Duration)
+	}
+	if len(wait.Blockers) != 1 || wait.Blockers[0].ID != 1 {
+		t.Errorf("expected the untracked lock ID 1 as blocker, got %+v", wait.Blockers)
+	}
+
+	// ID 4 is only 1s into its wait; with a lower threshold it shows up blocked by ID 2.
+	alerts = tracker.Overdue(base.Add(10*time.Second), 500*time.Millisecond, 0)
+	var found bool
+	for _, a := range alerts {
+		if a.Kind == AlertHold {
+			t.Error("a zero hold threshold should disable HOLD alerts")
+		}
+		if a.Lock.ID == 4 {
+			found = true
+			if len(a.Blockers) != 1 || a.Blockers[0].ID != 2 {
+				t.Errorf("expected ID 2 as blocker, got %+v", a.Blockers)
+			}
+		}
+	}
+	if !found {
+		t.Error("expected a WAIT alert for ID 4")
+	}
+}
+
+func TestTracker_Sources(t *testing.T) {
+	tracker := NewTracker()
+	base := time.Unix(1700000000, 0)
+	for _, e := range []deadlog.Event{
+		{Type: "LOCK", State: "START", Name: "a", ID: 1, Ts: base.UnixNano(), Source: "p1"},
+		{Type: "LOCK", State: "ACQUIRED", Name: "a", ID: 1, Ts: base.UnixNano(), Source: "p1"},
+		{Type: "LOCK", State: "START", Name: "a", ID: 1, Ts: base.UnixNano(), Source: "p2"},
+		{Type: "LOCK", State: "START", Name: "a", ID: 2, Ts: base.UnixNano(), Source: "p2"},
+		{Type: "LOCK", State: "ACQUIRED", Name: "a", ID: 2, Ts: base.UnixNano(), Source: "p2"},
+		// Releases ID 1 in p1 only.
+		{Type: "LOCK", State: "RELEASED", Name: "a", ID: 1, Ts: base.UnixNano(), Source: "p1"},
+	} {
+		tracker.Observe(e)
+	}
+
+	result := tracker.Result()
+	if len(result.Stuck) != 1 || result.Stuck[0].Source != "p2" || result.Stuck[0].ID != 1 {
+		t.Errorf("expected ID 1 stuck in p2, got %+v", result.Stuck)
+	}
+	if len(result.Held) != 1 || result.Held[0].Source != "p2" || result.Held[0].ID != 2 {
+		t.Errorf("expected ID 2 held in p2, got %+v", result.Held)
+	}
+
+	// Only locks in the same process can block a waiter.
+	tracker.Observe(deadlog.Event{Type: "LOCK", State: "START", Name: "a", ID: 3, Ts: base.UnixNano(), Source: "p1"})
+	for _, a := range tracker.Overdue(base.Add(time.Minute), time.Second, 0) {
+		if a.Lock.Source == "p1" && len(a.Blockers) != 0 {
+			t.Errorf("expected no blockers in p1, got %+v", a.Blockers)
+		}
+		if a.Lock.Source == "p2" && (len(a.Blockers) != 1 || a.Blockers[0].ID != 2) {
+			t.Errorf("expected ID 2 as blocker in p2, got %+v", a.Blockers)
+		}
+	}
+}
+
+func TestTracker_Sessions(t *testing.T) {
+	run1 := &deadlog.Header{PID: 10, Hostname: "host", Start: 1}
+	run2 := &deadlog.Header{PID: 20, Hostname: "host", Start: 2}
+	tracker := NewTracker()
+	for _, e := range []deadlog.Event{
+		{Type: "HEADER", Ts: 1, Header: run1},
+		{Type: "LOCK", State: "START", Name: "a", ID: 1, Ts: 1},
+		{Type: "LOCK", State: "ACQUIRED", Name: "a", ID: 1, Ts: 2},
+		{Type: "LOCK", State: "START", Name: "a", ID: 2, Ts: 3},
+		// Another logger in the same process doesn't start a new session.
+		{Type: "HEADER", Ts: 3, Header: &deadlog.Header{PID: 10, Hostname: "host", Start: 1}},
+		{Type: "WLOCK", State: "ACQUIRED", Name: "b", ID: 5, Ts: 3},
+		// The process crashed and restarted.
+		{Type: "HEADER", Ts: 4, Header: run2},
+		{Type: "LOCK", State: "START", Name: "a", ID: 3, Ts: 5},
+	} {
+		tracker.Observe(e)
+	}
+
+	result := tracker.Result()
+	if len(result.Stuck) != 1 || result.Stuck[0].ID != 3 {
+		t.Errorf("expected only ID 3 stuck in the current run, got %+v", result.Stuck)
+	}
+	if len(result.Held) != 0 {
+		t.Errorf("expected nothing held in the current run, got %+v", result.Held)
+	}
+	if len(result.Sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", result.Sessions)
+	}
+	ended, current := result.Sessions[0], result.Sessions[1]
+	if !ended.Ended || ended.Header.PID != 10 {
+		t.Errorf("expected the first run to have ended, got %+v", ended)
+	}
+	if len(ended.Stuck) != 1 || ended.Stuck[0].ID != 2 || len(ended.Held) != 1 || ended.Held[0].ID != 1 {
+		t.Errorf("expected the first run's outstanding locks, got %+v", ended)
+	}
+	if current.Ended || current.Header.PID != 20 {
+		t.Errorf("expected the second run to be current, got %+v", current)
+	}
+
+	// Untracked blockers of the old run are gone too.
+	for _, a := range tracker.Overdue(time.Unix(0, 5).Add(time.Minute), time.Second, 0) {
+		if len(a.Blockers) != 0 {
+			t.Errorf("expected no blockers after the restart, got %+v", a.Blockers)
+		}
+	}
+
+	var buf bytes.Buffer
+	PrintReport(&buf, result)
+	for _, want := range []string{"=== SESSIONS", "pid 10 on host", "(restarted)", "Outstanding at restart: 1 stuck, 1 held", "pid 20 on host"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report should contain %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestTracker_SessionsBeforeHeader(t *testing.T) {
+	tracker := NewTracker()
+	for _, e := range []deadlog.Event{
+		// A run that logged no header.
+		{Type: "LOCK", State: "START", Name: "a", ID: 1, Ts: 1},
+		{Type: "LOCK", State: "START", Name: "a", ID: 2, Ts: 2},
+		{Type: "LOCK", State: "ACQUIRED", Name: "a", ID: 2, Ts: 3},
+		{Type: "HEADER", Ts: 4, Header: &deadlog.Header{PID: 10, Hostname: "host", Start: 4}},
+		{Type: "LOCK", State: "START", Name: "a", ID: 3, Ts: 5},
+	} {
+		tracker.Observe(e)
+	}
+
+	result := tracker.Result()
+	if len(result.Stuck) != 1 || result.Stuck[0].ID != 3 || len(result.Held) != 0 {
+		t.Errorf("expected only ID 3 outstanding in the current run, got stuck %+v, held %+v", result.Stuck, result.Held)
+	}
+	if len(result.Sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", result.Sessions)
+	}
+	before := result.Sessions[0]
+	if before.Header != nil || !before.Ended || len(before.Stuck) != 1 || len(before.Held) != 1 {
+		t.Errorf("expected an ended session without a header holding IDs 1 and 2, got %+v", before)
+	}
+
+	var buf bytes.Buffer
+	PrintReport(&buf, result)
+	if !strings.Contains(buf.String(), "unknown process before the first header (restarted)") {
+		t.Errorf("expected the headerless run in the report:\n%s", buf.String())
+	}
+}
+
+func TestTracker_SessionsPerPackage(t *testing.T) {
+	// go test -json runs each package in its own test binary, so their
+	// headers and IDs are independent even though they share a source.
+	tracker := NewTracker()
+	for _, e := range []deadlog.Event{
+		{Type: "HEADER", Ts: 1, Package: "example.com/a", Header: &deadlog.Header{PID: 10, Hostname: "host", Start: 1}},
+		{Type: "LOCK", State: "START", Name: "a", ID: 1, Ts: 2, Package: "example.com/a"},
+		{Type: "HEADER", Ts: 3, Package: "example.com/b", Header: &deadlog.Header{PID: 20, Hostname: "host", Start: 3}},
+		{Type: "LOCK", State: "START", Name: "b", ID: 1, Ts: 4, Package: "example.com/b"},
+		{Type: "LOCK", State: "ACQUIRED", Name: "b", ID: 1, Ts: 5, Package: "example.com/b"},
+		{Type: "LOCK", State: "START", Name: "c", ID: 2, Ts: 6, Package: "example.com/b"},
+	} {
+		tracker.Observe(e)
+	}
+
+	result := tracker.Result()
+	if len(result.Stuck) != 2 {
+		t.Errorf("expected a stuck lock in each package, got %+v", result.Stuck)
+	}
+	if len(result.Held) != 1 || result.Held[0].Package != "example.com/b" {
+		t.Errorf("expected b held in example.com/b, got %+v", result.Held)
+	}
+	if len(result.Sessions) != 2 {
+		t.Fatalf("expected a session per package, got %+v", result.Sessions)
+	}
+	for i, pkg := range []string{"example.com/a", "example.com/b"} {
+		if s := result.Sessions[i]; s.Ended || s.Package != pkg {
+			t.Errorf("expected a current session of %s, got %+v", pkg, s)
+		}
+	}
+}
+
+func TestPrintAlert(t *testing.T) {
+	a := Alert{
+		Kind:     AlertWait,
+		Lock:     LockInfo{Type: "LOCK", Name: "apply-damage", ID: 1, Trace: "applyDamage:33"},
+		Duration: 31 * time.Second,
+		Blockers: []LockInfo{{Type: "LOCK", Name: "apply-damage", ID: 2, Trace: "updateHealth:25"}},
+	}
+
+	var buf strings.Builder
+	PrintAlert(&buf, a)
+	out := buf.String()
+	for _, want := range []string{"WAIT: waiting for 31s", "applyDamage:33", "Blocked by:", "updateHealth:25"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("alert should contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestTracker_ServeHTTP(t *testing.T) {
+	tracker := NewTracker()
+	m := deadlog.New(deadlog.WithName("served"), deadlog.WithTrace(1), deadlog.WithLogger(tracker.Observe))
+
+	_ = m.LockFunc() // ignore unlock function
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Lock()
+		m.Unlock()
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	srv := httptest.NewServer(tracker)
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	// The snapshot reads back as the same result.
+	result, err := Analyze(resp.Body)
+	if err != nil {
+		t.Fatalf("Analyze error: %v", err)
+	}
+	want := tracker.Result()
+	if len(result.Held) != 1 || result.Held[0].ID != want.Held[0].ID || result.Held[0].Trace == "" {
+		t.Errorf("expected held lock %+v, got %+v", want.Held, result.Held)
+	}
+	if len(result.Stuck) != 1 || result.Stuck[0].ID != want.Stuck[0].ID || result.Stuck[0].Ts != want.Stuck[0].Ts {
+		t.Errorf("expected stuck lock %+v, got %+v", want.Stuck, result.Stuck)
+	}
+
+	m.Unlock()
+	<-done
+}
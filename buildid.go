@@ -0,0 +1,59 @@
+package deadlog
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"os"
+	"sync"
+)
+
+// BuildID returns the Go build ID of the running executable, or "" if it
+// cannot be determined. It is read once and cached.
+var BuildID = sync.OnceValue(func() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	id, err := ReadBuildID(exe)
+	if err != nil {
+		return ""
+	}
+	return id
+})
+
+// ReadBuildID reads the Go build ID from the ELF executable at path.
+func ReadBuildID(path string) (string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return elfBuildID(f)
+}
+
+func elfBuildID(f *elf.File) (string, error) {
+	sec := f.Section(".note.go.buildid")
+	if sec == nil {
+		return "", errors.New("no Go build ID note")
+	}
+	data, err := sec.Data()
+	if err != nil {
+		return "", err
+	}
+	// The note is namesz, descsz, type, then the padded name "Go" and the ID.
+	if len(data) < 16 {
+		return "", errors.New("short Go build ID note")
+	}
+	namesz := f.ByteOrder.Uint32(data[0:4])
+	descsz := f.ByteOrder.Uint32(data[4:8])
+	name := data[12:]
+	if namesz != 4 || !bytes.HasPrefix(name, []byte("Go\x00\x00")) {
+		return "", errors.New("malformed Go build ID note")
+	}
+	desc := name[4:]
+	if uint32(len(desc)) < descsz {
+		return "", errors.New("short Go build ID note")
+	}
+	return string(desc[:descsz]), nil
+}
@@ -0,0 +1,33 @@
+package deadlog
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestBuildID(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("build IDs are only read from ELF binaries")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := ReadBuildID(exe)
+	if err != nil {
+		t.Fatalf("ReadBuildID error: %v", err)
+	}
+	if id == "" {
+		t.Error("expected a non-empty build ID")
+	}
+	if BuildID() != id {
+		t.Errorf("BuildID() = %q, want %q", BuildID(), id)
+	}
+}
+
+func TestReadBuildID_NotELF(t *testing.T) {
+	if _, err := ReadBuildID("buildid.go"); err == nil {
+		t.Error("expected an error for a non-ELF file")
+	}
+}
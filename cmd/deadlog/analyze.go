@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stevenctl/deadlog"
+	"github.com/stevenctl/deadlog/analyze"
+)
+
+func runAnalyze(args []string) {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or sarif")
+	binary := fs.String("binary", "", "symbolize PCs logged WithPCs using this binary")
+	names := fs.String("name", "", "only analyze events with these comma-separated names")
+	goroutines := fs.String("goroutines", "", "match stuck locks to the goroutines of a Go traceback, such as a SIGQUIT dump; [source=]file to pick the log of the hung process")
+	srcRoot := fs.String("srcroot", ".", "repository root that SARIF locations are relative to")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: deadlog analyze [flags] <file|glob>...")
+		fmt.Fprintln(os.Stderr, "       deadlog analyze [flags] -  (read from stdin)")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	inputs := parseInterspersed(fs, args)
+	if len(inputs) < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *format != "text" && *format != "sarif" {
+		fmt.Fprintf(os.Stderr, "Unknown format: %s\n", *format)
+		os.Exit(1)
+	}
+
+	paths, err := expandInputs(inputs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var events iter.Seq2[deadlog.Event, error]
+	if paths[0] == "-" {
+		r, err := openInput("-")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		events = analyze.ResolveTraces(analyze.Events(r))
+	} else {
+		// Rotated files are read in order and separate logs merged, with
+		// findings labelled by log so that IDs of different processes
+		// don't collide.
+		events = analyze.FileEvents(paths...)
+	}
+	if *names != "" {
+		byName := analyze.ByName(strings.Split(*names, ",")...)
+		// Keep headers so that restarts still split sessions.
+		events = analyze.Filter(events, func(e deadlog.Event) bool {
+			return e.Type == "HEADER" || byName(e)
+		})
+	}
+	result, err := analyze.AnalyzeEvents(events)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *binary != "" {
+		sym, err := analyze.NewSymbolizer(*binary)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := sym.Symbolize(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	if *goroutines != "" {
+		source, path, ok := strings.Cut(*goroutines, "=")
+		if !ok {
+			source, path = "", *goroutines
+			// A state dump's header names the process it is of.
+			if h := analyze.FileHeader(path); h != nil {
+				if s, err := analyze.DumpSource(result, h); err == nil {
+					source = s
+				}
+			}
+		}
+		gs, err := analyze.ParseGoroutinesFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(gs) == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: no goroutines found in %s\n", path)
+		}
+		if err := analyze.MatchGoroutines(result, source, gs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v; use --goroutines source=%s\n", err, path)
+			os.Exit(1)
+		}
+	}
+
+	if *format == "sarif" {
+		if len(result.Malformed) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d malformed lines: %s\n", len(result.Malformed), result.MalformedString())
+		}
+		root, err := analyze.NewSourceRoot(*srcRoot)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := analyze.WriteSARIF(os.Stdout, result, root); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		analyze.PrintReport(os.Stdout, result)
+	}
+
+	// Exit with non-zero if issues found
+	if len(result.Stuck) > 0 || len(result.Held) > 0 || len(result.Cycles) > 0 {
+		os.Exit(1)
+	}
+}
+
+// expandInputs expands glob patterns in the input arguments. "-" reads
+// stdin and can't be combined with other inputs.
+func expandInputs(args []string) ([]string, error) {
+	if len(args) == 1 && args[0] == "-" {
+		return args, nil
+	}
+	var paths []string
+	for _, arg := range args {
+		if arg == "-" {
+			return nil, errors.New("stdin can't be combined with other inputs")
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			// Not a pattern, or one with no matches; let open report it.
+			matches = []string{arg}
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
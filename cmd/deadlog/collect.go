@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/stevenctl/deadlog"
+	"github.com/stevenctl/deadlog/analyze"
+)
+
+func runCollect(args []string) {
+	fs := flag.NewFlagSet("collect", flag.ExitOnError)
+	listen := fs.String("listen", "", "address to receive events on, host:port or unix:/path")
+	output := fs.String("o", "", "write the merged log, in arrival order, to a file instead of stdout")
+	watch := fs.Bool("watch", false, "track the combined stream and alert on long waits and holds")
+	wait := fs.Duration("wait", 5*time.Second, "with --watch, alert when a lock has been waiting longer than this (0 disables)")
+	hold := fs.Duration("hold", 30*time.Second, "with --watch, alert when a tracked lock has been held longer than this (0 disables)")
+	interval := fs.Duration("interval", time.Second, "with --watch, how often to check for overdue locks")
+	serve := fs.String("http", "", "serve the tracked operations on this address, for deadlog top")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: deadlog collect --listen <addr> [flags]")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if *listen == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	network, address := "tcp", *listen
+	if path, ok := strings.CutPrefix(*listen, "unix:"); ok {
+		network, address = "unix", path
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Collecting events on %s %s\n", network, l.Addr())
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+
+	var tracker *analyze.Tracker
+	if *watch || *serve != "" {
+		tracker = analyze.NewTracker()
+	}
+	if *watch {
+		alerts := &alerter{tracker: tracker, wait: *wait, hold: *hold}
+		go func() {
+			ticker := time.NewTicker(*interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				alerts.check()
+			}
+		}()
+	}
+	if *serve != "" {
+		go func() {
+			if err := http.ListenAndServe(*serve, tracker); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// Stop on interrupt, closing the listener so Collect returns and the
+	// merged log is complete.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		l.Close()
+	}()
+
+	err = analyze.Collect(l, func(e deadlog.Event, err error) {
+		if err != nil {
+			// A client sending garbage or disconnecting mustn't stop the
+			// collector.
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			return
+		}
+		if err := enc.Encode(e); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if tracker != nil {
+			tracker.Observe(e)
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
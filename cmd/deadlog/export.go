@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/stevenctl/deadlog/analyze"
+)
+
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "", "output format: chrome-trace or folded")
+	value := fs.String("value", analyze.FoldedWait, "value of folded stacks: wait or hold")
+	output := fs.String("o", "", "write to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: deadlog export --format <format> [-o out] <file>")
+		fmt.Fprintln(os.Stderr, "       deadlog export --format <format> [-o out] -  (read from stdin)")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	inputs := parseInterspersed(fs, args)
+	if len(inputs) < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	var write func(io.Writer, []analyze.Span) error
+	switch *format {
+	case "chrome-trace":
+		write = analyze.WriteChromeTrace
+	case "folded":
+		if *value != analyze.FoldedWait && *value != analyze.FoldedHold {
+			fmt.Fprintf(os.Stderr, "Error: unknown value %q (want wait or hold)\n", *value)
+			os.Exit(1)
+		}
+		write = func(w io.Writer, spans []analyze.Span) error {
+			return analyze.WriteFolded(w, spans, *value)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (want chrome-trace or folded)\n", *format)
+		os.Exit(1)
+	}
+
+	r, err := openInput(inputs[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer r.Close()
+
+	spans, err := analyze.Spans(analyze.ResolveTraces(analyze.Events(r)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *output == "" {
+		if err := write(os.Stdout, spans); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	out, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := write(out, spans); err != nil {
+		out.Close()
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := out.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -2,7 +2,9 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/stevenctl/deadlog/analyze"
@@ -16,12 +18,21 @@ func main() {
 
 	switch os.Args[1] {
 	case "analyze":
-		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "Usage: deadlog analyze <file>")
-			fmt.Fprintln(os.Stderr, "       deadlog analyze -  (read from stdin)")
-			os.Exit(1)
-		}
-		runAnalyze(os.Args[2])
+		runAnalyze(os.Args[2:])
+	case "watch":
+		runWatch(os.Args[2:])
+	case "top":
+		runTop(os.Args[2:])
+	case "report":
+		runReport(os.Args[2:])
+	case "export":
+		runExport(os.Args[2:])
+	case "pprof":
+		runPprof(os.Args[2:])
+	case "collect":
+		runCollect(os.Args[2:])
+	case "run":
+		runRun(os.Args[2:])
 	case "help", "-h", "--help":
 		printUsage()
 	default:
@@ -35,33 +46,79 @@ func printUsage() {
 	fmt.Println("deadlog - Debug Go mutex deadlocks")
 	fmt.Println()
 	fmt.Println("Usage:")
-	fmt.Println("  deadlog analyze <file>   Analyze a log file for deadlocks")
+	fmt.Println("  deadlog run [flags] -- <command> [args...]")
+	fmt.Println("                           Run a program, dump goroutines on a hang, and report")
+	fmt.Println("  deadlog analyze <file>...")
+	fmt.Println("                           Analyze log files or globs for deadlocks")
 	fmt.Println("  deadlog analyze -        Read from stdin")
+	fmt.Println("  deadlog watch <file|->   Follow a log and alert on long waits and holds")
+	fmt.Println("  deadlog top <file|-|url> Live dashboard of waiters and holders per lock name")
+	fmt.Println("  deadlog report --html <out> <file|->")
+	fmt.Println("                           Render an HTML timeline of lock activity")
+	fmt.Println("  deadlog export --format <format> <file|->")
+	fmt.Println("                           Convert a log for other tools")
+	fmt.Println("  deadlog pprof <file|-> -o <out.pb.gz>")
+	fmt.Println("                           Write a contention profile for go tool pprof")
+	fmt.Println("  deadlog collect --listen <addr>")
+	fmt.Println("                           Receive events from NetworkSink clients")
 	fmt.Println("  deadlog help             Show this help")
 	fmt.Println()
+	fmt.Println("Run flags:")
+	fmt.Println("  --hang-after <duration>  Send SIGQUIT when a lock waits longer than this (default 30s)")
+	fmt.Println("  --dump <path>            Write the goroutine dump taken on a hang to a file")
+	fmt.Println("  -o <path>                Also write the event log to a file")
+	fmt.Println()
+	fmt.Println("Analyze flags:")
+	fmt.Println("  --format text|sarif      Output format (default text)")
+	fmt.Println("  --binary <path>          Symbolize PCs logged WithPCs using this binary")
+	fmt.Println("  --name <a,b,...>         Only analyze events with these names")
+	fmt.Println("  --goroutines <dump>      Match stuck locks to a goroutine dump; use <source>=<dump>")
+	fmt.Println("                           to pick the log of the hung process among several")
+	fmt.Println("  --srcroot <dir>          Make SARIF locations relative to this repository root (default .)")
+	fmt.Println()
+	fmt.Println("Watch flags:")
+	fmt.Println("  --wait <duration>        Alert on locks waiting longer than this (default 5s)")
+	fmt.Println("  --hold <duration>        Alert on locks held longer than this (default 30s)")
+	fmt.Println("  --fail-fast              Exit non-zero on the first alert")
+	fmt.Println()
+	fmt.Println("Export flags:")
+	fmt.Println("  --format chrome-trace    Trace Event Format JSON for Perfetto or chrome://tracing")
+	fmt.Println("  --format folded          Folded stacks for flame graphs")
+	fmt.Println("  --value wait|hold        Time to fold into stacks (default wait)")
+	fmt.Println("  -o <path>                Write to a file instead of stdout")
+	fmt.Println()
+	fmt.Println("Collect flags:")
+	fmt.Println("  --listen <addr>          Listen on host:port, or unix:/path for a unix socket")
+	fmt.Println("  -o <path>                Append the merged log to a file instead of stdout")
+	fmt.Println("  --watch                  Alert on long waits and holds, with --wait and --hold")
+	fmt.Println("  --http <addr>            Serve tracked operations for deadlog top")
+	fmt.Println()
 	fmt.Println("Example:")
-	fmt.Println("  go run ./myapp 2>&1 | deadlog analyze -")
+	fmt.Println("  go build -o myapp . && deadlog run --hang-after 10s -- ./myapp")
 }
 
-func runAnalyze(path string) {
-	var result *analyze.Result
-	var err error
-
+// openInput opens a log file, or stdin for "-". Compressed input is
+// decompressed.
+func openInput(path string) (io.ReadCloser, error) {
 	if path == "-" {
-		result, err = analyze.Analyze(os.Stdin)
-	} else {
-		result, err = analyze.AnalyzeFile(path)
+		r, err := analyze.Decompress(os.Stdin)
+		return io.NopCloser(r), err
 	}
+	return analyze.OpenLog(path)
+}
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
-
-	analyze.PrintReport(os.Stdout, result)
-
-	// Exit with non-zero if issues found
-	if len(result.Stuck) > 0 || len(result.Held) > 0 {
-		os.Exit(1)
+// parseInterspersed parses flags that may appear before or after positional
+// arguments, like "deadlog pprof app.log -o out.pb.gz", and returns the
+// positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		_ = fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
 	}
 }
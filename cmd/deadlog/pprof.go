@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/stevenctl/deadlog/analyze"
+)
+
+func runPprof(args []string) {
+	fs := flag.NewFlagSet("pprof", flag.ExitOnError)
+	output := fs.String("o", "", "write the gzipped profile to this file")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: deadlog pprof <file> -o <contention.pb.gz>")
+		fmt.Fprintln(os.Stderr, "       deadlog pprof - -o <contention.pb.gz>  (read from stdin)")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	inputs := parseInterspersed(fs, args)
+	if len(inputs) != 1 || *output == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	r, err := openInput(inputs[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer r.Close()
+
+	spans, err := analyze.Spans(analyze.ResolveTraces(analyze.Events(r)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	out, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := analyze.WritePprof(out, spans); err != nil {
+		out.Close()
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := out.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// quit kills p, as there is no SIGQUIT to ask for a goroutine dump.
+func quit(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/stevenctl/deadlog"
+	"github.com/stevenctl/deadlog/analyze"
+)
+
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	htmlOut := fs.String("html", "", "write a self-contained HTML timeline to this file")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: deadlog report --html <out.html> <file>")
+		fmt.Fprintln(os.Stderr, "       deadlog report --html <out.html> -  (read from stdin)")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	inputs := parseInterspersed(fs, args)
+	if len(inputs) < 1 || *htmlOut == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	r, err := openInput(inputs[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer r.Close()
+
+	// Track findings while collecting spans, so the input is read once.
+	tracker := analyze.NewTracker()
+	events := analyze.Map(analyze.ResolveTraces(analyze.Events(r)), func(e deadlog.Event) deadlog.Event {
+		tracker.Observe(e)
+		return e
+	})
+	spans, err := analyze.Spans(events)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	out, err := os.Create(*htmlOut)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := analyze.WriteHTML(out, spans, tracker.Result()); err != nil {
+		out.Close()
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := out.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
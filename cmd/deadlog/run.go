@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/stevenctl/deadlog"
+	"github.com/stevenctl/deadlog/analyze"
+)
+
+// runFD is the descriptor the child writes events to: the first of
+// exec.Cmd.ExtraFiles, after stdin, stdout and stderr.
+const runFD = 3
+
+func runRun(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	hangAfter := fs.Duration("hang-after", 30*time.Second, "treat a lock waiting longer than this as a hang")
+	output := fs.String("o", "", "also write the event log to a file")
+	dump := fs.String("dump", "", "write the goroutine dump taken on a hang to a file")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: deadlog run [flags] -- <command> [args...]")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 || *hangAfter <= 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	events, w, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// The goroutine dump the runtime prints on SIGQUIT goes to stderr; keep
+	// what follows the signal.
+	stderr := &dumpWriter{w: os.Stderr}
+	cmd := exec.Command(fs.Arg(0), fs.Args()[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = stderr
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.Env = append(os.Environ(), deadlog.FDEnv+"="+strconv.Itoa(runFD))
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	w.Close()
+
+	// The terminal sends interrupts to the child too, so only outlive it to
+	// report. Forward terminations.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for s := range sig {
+			if s != os.Interrupt {
+				_ = cmd.Process.Signal(s)
+			}
+		}
+	}()
+
+	var log io.Writer = io.Discard
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		log = f
+	}
+
+	tracker := analyze.NewTracker()
+	var malformed []analyze.LineError
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		for e, err := range analyze.ResolveTraces(analyze.Events(io.TeeReader(events, log))) {
+			if err != nil {
+				var lineErr *analyze.LineError
+				if errors.As(err, &lineErr) {
+					malformed = append(malformed, *lineErr)
+				}
+				continue
+			}
+			tracker.Observe(e)
+		}
+	}()
+
+	// Watch for operations waiting past --hang-after.
+	var hung atomic.Bool
+	exited := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(min(*hangAfter/4, time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-exited:
+				return
+			case <-ticker.C:
+			}
+			alerts := tracker.Overdue(time.Now(), *hangAfter, 0)
+			if len(alerts) == 0 {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "deadlog: %d lock(s) waiting longer than %s, sending SIGQUIT to %d\n", len(alerts), *hangAfter, cmd.Process.Pid)
+			for _, a := range alerts {
+				analyze.PrintAlert(os.Stderr, a)
+			}
+			hung.Store(true)
+			stderr.start()
+			if err := quit(cmd.Process); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			return
+		}
+	}()
+
+	err = cmd.Wait()
+	close(exited)
+	// Grandchildren may hold the pipe open; don't wait on them for long.
+	select {
+	case <-read:
+	case <-time.After(time.Second):
+		events.Close()
+		<-read
+	}
+
+	result := tracker.Result()
+	result.SetMalformed(malformed)
+	if hung.Load() {
+		gs, err := analyze.ParseGoroutines(bytes.NewReader(stderr.dump()))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		if err := analyze.MatchGoroutines(result, "", gs); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	fmt.Println()
+	analyze.PrintReport(os.Stdout, result)
+
+	if *dump != "" && hung.Load() {
+		if err := os.WriteFile(*dump, stderr.dump(), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Goroutine dump written to %s\n", *dump)
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case hung.Load():
+		os.Exit(1)
+	case errors.As(err, &exitErr):
+		os.Exit(exitErr.ExitCode())
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// dumpWriter passes the child's stderr through, keeping a copy of what is
+// written after start.
+type dumpWriter struct {
+	w io.Writer
+
+	mu        sync.Mutex
+	capturing bool
+	buf       bytes.Buffer
+}
+
+func (d *dumpWriter) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	if d.capturing {
+		d.buf.Write(p)
+	}
+	d.mu.Unlock()
+	return d.w.Write(p)
+}
+
+func (d *dumpWriter) start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.capturing = true
+}
+
+func (d *dumpWriter) dump() []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.buf.Bytes()
+}
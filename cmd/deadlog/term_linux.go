@@ -0,0 +1,11 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// ioctl requests to get and set the terminal attributes.
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
@@ -0,0 +1,13 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// cbreak is not supported here, so keys are read a line at a time.
+func cbreak(*os.File) (func(), error) {
+	return nil, errors.New("terminal modes are not supported on this platform")
+}
@@ -0,0 +1,47 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// cbreak puts the terminal into character-at-a-time mode without echo,
+// returning a function that restores the previous settings.
+func cbreak(tty *os.File) (func(), error) {
+	// Fd would put the file into blocking mode, which rules out read
+	// deadlines, so use the raw connection.
+	conn, err := tty.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var old syscall.Termios
+	if err := termios(conn, ioctlGetTermios, &old); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := termios(conn, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	return func() { _ = termios(conn, ioctlSetTermios, &old) }, nil
+}
+
+// termios gets or sets the attributes of a terminal.
+func termios(conn syscall.RawConn, req uintptr, t *syscall.Termios) error {
+	var errno syscall.Errno
+	err := conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(t)))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stevenctl/deadlog/analyze"
+)
+
+// ANSI escape sequences used by the dashboard.
+const (
+	ansiClear      = "\x1b[H\x1b[2J"
+	ansiAltScreen  = "\x1b[?1049h"
+	ansiMainScreen = "\x1b[?1049l"
+	ansiHideCursor = "\x1b[?25l"
+	ansiShowCursor = "\x1b[?25h"
+	ansiReverse    = "\x1b[7m"
+	ansiBold       = "\x1b[1m"
+	ansiReset      = "\x1b[0m"
+	ansiClearToEOL = "\x1b[K"
+)
+
+var sortOrders = []string{analyze.SortByWaiters, analyze.SortByWait, analyze.SortByHold}
+
+// topSource provides the current outstanding operations.
+type topSource interface {
+	Result() (*analyze.Result, error)
+}
+
+// streamSource tracks events read from a log file or stdin.
+type streamSource struct {
+	tracker *analyze.Tracker
+
+	mu  sync.Mutex
+	err error
+}
+
+func newStreamSource(r io.Reader) *streamSource {
+	s := &streamSource{tracker: analyze.NewTracker()}
+	go func() {
+		for e, err := range analyze.ResolveTraces(analyze.Events(r)) {
+			if err != nil {
+				var lineErr *analyze.LineError
+				if errors.As(err, &lineErr) {
+					continue
+				}
+				s.mu.Lock()
+				s.err = err
+				s.mu.Unlock()
+				return
+			}
+			s.tracker.Observe(e)
+		}
+	}()
+	return s
+}
+
+func (s *streamSource) Result() (*analyze.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tracker.Result(), s.err
+}
+
+// httpSource polls a Tracker served by a running process.
+type httpSource struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSource) Result() (*analyze.Result, error) {
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", s.url, resp.Status)
+	}
+	tracker := analyze.NewTracker()
+	for e, err := range analyze.Events(resp.Body) {
+		if err != nil {
+			return nil, err
+		}
+		tracker.Observe(e)
+	}
+	return tracker.Result(), nil
+}
+
+// topUI holds the dashboard state shared by the render loop and input.
+type topUI struct {
+	source string
+	in     topSource
+
+	mu       sync.Mutex
+	sortIdx  int
+	cursor   int
+	selected string // name being inspected, or "" for the overview
+	names    []string
+	quit     bool
+}
+
+func runTop(args []string) {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	interval := fs.Duration("interval", time.Second, "refresh interval")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: deadlog top [flags] <file>")
+		fmt.Fprintln(os.Stderr, "       deadlog top [flags] -  (read from stdin)")
+		fmt.Fprintln(os.Stderr, "       deadlog top [flags] http://host:port/debug/deadlog")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	inputs := parseInterspersed(fs, args)
+	if len(inputs) < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	source := inputs[0]
+	var in topSource
+	switch {
+	case source == "-":
+		in = newStreamSource(os.Stdin)
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		in = &httpSource{url: source, client: &http.Client{Timeout: *interval}}
+	default:
+		fl, err := analyze.Follow(source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer fl.Close()
+		in = newStreamSource(fl)
+	}
+
+	ui := &topUI{source: source, in: in}
+
+	// Keys are read from the terminal, since stdin may be the log stream.
+	redraw := make(chan struct{}, 1)
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		defer tty.Close()
+		lineMode := true
+		if restore, err := cbreak(tty); err == nil {
+			defer restore()
+			lineMode = false
+		}
+		go ui.readKeys(tty, lineMode, redraw)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	out := bufio.NewWriter(os.Stdout)
+	fmt.Fprint(out, ansiAltScreen, ansiHideCursor)
+	defer func() {
+		fmt.Fprint(out, ansiShowCursor, ansiMainScreen)
+		out.Flush()
+	}()
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		ui.render(out)
+		out.Flush()
+		select {
+		case <-ticker.C:
+		case <-redraw:
+		case <-interrupt:
+			return
+		}
+		ui.mu.Lock()
+		quit := ui.quit
+		ui.mu.Unlock()
+		if quit {
+			return
+		}
+	}
+}
+
+// escTimeout is how long to wait for the rest of an escape sequence before
+// taking ESC as a key of its own.
+const escTimeout = 50 * time.Millisecond
+
+// readKeys handles key presses until the terminal is closed. In line mode
+// every key is followed by a newline, so only an empty line counts as Enter.
+func (ui *topUI) readKeys(tty *os.File, lineMode bool, redraw chan<- struct{}) {
+	r := bufio.NewReader(tty)
+	prev := byte('\n')
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		if lineMode && b == '\n' && prev != '\n' {
+			prev = b
+			continue
+		}
+		prev = b
+		key := string(b)
+		if b == 0x1b {
+			key = readEscape(r, tty)
+		}
+		ui.mu.Lock()
+		ui.handleKey(key)
+		ui.mu.Unlock()
+		select {
+		case redraw <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// readEscape reads the rest of an escape sequence after ESC, returning the
+// arrow key it names, or "esc" for ESC on its own. Sequences arrive at once,
+// so ESC is on its own if nothing follows it within escTimeout.
+func readEscape(r *bufio.Reader, tty *os.File) string {
+	if r.Buffered() == 0 {
+		if err := tty.SetReadDeadline(time.Now().Add(escTimeout)); err != nil {
+			// Without deadlines, only buffered input can be checked.
+			return "esc"
+		}
+		defer tty.SetReadDeadline(time.Time{})
+	}
+	if next, err := r.ReadByte(); err != nil || next != '[' {
+		return "esc"
+	}
+	arrow, _ := r.ReadByte()
+	return map[byte]string{'A': "up", 'B': "down", 'C': "right", 'D': "left"}[arrow]
+}
+
+// handleKey applies a key press. ui.mu must be held.
+func (ui *topUI) handleKey(key string) {
+	switch key {
+	case "q", "esc":
+		ui.quit = true
+	case "s":
+		ui.sortIdx = (ui.sortIdx + 1) % len(sortOrders)
+	case "k", "up":
+		ui.cursor = max(ui.cursor-1, 0)
+	case "j", "down":
+		ui.cursor = min(ui.cursor+1, max(len(ui.names)-1, 0))
+	case "\n", "\r", "l", "right":
+		if ui.selected == "" && ui.cursor < len(ui.names) {
+			ui.selected = ui.names[ui.cursor]
+		}
+	case "b", "\x7f", "left":
+		ui.selected = ""
+	}
+}
+
+func (ui *topUI) render(w io.Writer) {
+	result, err := ui.in.Result()
+	now := time.Now()
+
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+
+	fmt.Fprint(w, ansiClear)
+	fmt.Fprintf(w, "%sdeadlog top%s - %s - %s%s\n", ansiBold, ansiReset, ui.source, now.Format(time.TimeOnly), ansiClearToEOL)
+	if err != nil {
+		fmt.Fprintf(w, "Error: %v%s\n", err, ansiClearToEOL)
+	}
+	if result == nil {
+		result = &analyze.Result{}
+	}
+	fmt.Fprintln(w)
+
+	if ui.selected != "" {
+		ui.renderDetail(w, result, now)
+		fmt.Fprintf(w, "\n[b] back  [q] quit\n")
+		return
+	}
+
+	stats := analyze.Summarize(result, now)
+	analyze.SortStats(stats, sortOrders[ui.sortIdx])
+	ui.names = ui.names[:0]
+	for _, s := range stats {
+		ui.names = append(ui.names, s.Name)
+	}
+	ui.cursor = min(ui.cursor, max(len(ui.names)-1, 0))
+
+	fmt.Fprintf(w, "  %-30s %8s %8s %10s %10s   (sorted by %s)\n", "NAME", "WAITERS", "HOLDERS", "MAX WAIT", "MAX HOLD", sortOrders[ui.sortIdx])
+	if len(stats) == 0 {
+		fmt.Fprintln(w, "  (no outstanding locks)")
+	}
+	for i, s := range stats {
+		line := fmt.Sprintf("  %-30s %8d %8d %10s %10s", displayName(s.Name), s.Waiters, s.Holders, formatDuration(s.MaxWait), formatDuration(s.MaxHold))
+		if i == ui.cursor {
+			line = ansiReverse + line + ansiReset
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "\n[j/k] select  [enter] details  [s] sort  [q/esc] quit\n")
+}
+
+func (ui *topUI) renderDetail(w io.Writer, result *analyze.Result, now time.Time) {
+	fmt.Fprintf(w, "  %s\n\n", displayName(ui.selected))
+	fmt.Fprintf(w, "  %-8s %-6s %-10s %10s\n", "STATE", "TYPE", "ID", "FOR")
+	printOps := func(state string, infos []analyze.LockInfo) {
+		for _, info := range infos {
+			if info.Name != ui.selected {
+				continue
+			}
+			fmt.Fprintf(w, "  %-8s %-6s %-10d %10s\n", state, info.Type, info.ID, formatDuration(now.Sub(time.Unix(0, info.Ts))))
+			for _, f := range info.Frames {
+				fmt.Fprintf(w, "           %s %s:%d\n", f.Func, f.File, f.Line)
+			}
+			if len(info.Frames) == 0 && info.Trace != "" {
+				fmt.Fprintf(w, "           Trace: %s\n", info.Trace)
+			}
+		}
+	}
+	printOps("WAITING", result.Stuck)
+	printOps("HOLDING", result.Held)
+}
+
+func displayName(name string) string {
+	if name == "" {
+		return "(unnamed)"
+	}
+	return name
+}
+
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/stevenctl/deadlog/analyze"
+)
+
+func runWatch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	wait := fs.Duration("wait", 5*time.Second, "alert when a lock has been waiting longer than this (0 disables)")
+	hold := fs.Duration("hold", 30*time.Second, "alert when a tracked lock has been held longer than this (0 disables)")
+	interval := fs.Duration("interval", time.Second, "how often to check for overdue locks")
+	failFast := fs.Bool("fail-fast", false, "exit with status 1 on the first alert")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: deadlog watch [flags] <file>")
+		fmt.Fprintln(os.Stderr, "       deadlog watch [flags] -  (read from stdin)")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	inputs := parseInterspersed(fs, args)
+	if len(inputs) < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	var r io.Reader = os.Stdin
+	caughtUp := func() bool { return true }
+	if path := inputs[0]; path != "-" {
+		fl, err := analyze.Follow(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer fl.Close()
+		r = fl
+		// Don't alert on operations that complete later in the existing file.
+		caughtUp = fl.CaughtUp
+	}
+
+	tracker := analyze.NewTracker()
+	alerts := &alerter{tracker: tracker, wait: *wait, hold: *hold, failFast: *failFast}
+
+	go func() {
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if caughtUp() {
+				alerts.check()
+			}
+		}
+	}()
+
+	for e, err := range analyze.ResolveTraces(analyze.Events(r)) {
+		if err != nil {
+			var lineErr *analyze.LineError
+			if errors.As(err, &lineErr) {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		tracker.Observe(e)
+	}
+
+	// Input ended (stdin closed); report anything still overdue.
+	alerts.check()
+	if alerts.count() > 0 {
+		os.Exit(1)
+	}
+}
+
+// alerter prints alerts for the overdue operations of a tracker.
+type alerter struct {
+	tracker    *analyze.Tracker
+	wait, hold time.Duration
+	failFast   bool
+
+	mu      sync.Mutex
+	alerted map[string]struct{}
+	alerts  int
+}
+
+// check prints an alert for every overdue operation that wasn't overdue at
+// the previous check, so each is only reported once for as long as it stays
+// overdue.
+func (a *alerter) check() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	current := make(map[string]struct{})
+	for _, alert := range a.tracker.Overdue(time.Now(), a.wait, a.hold) {
+		key := fmt.Sprintf("%s|%s|%s|%s|%d", alert.Kind, alert.Lock.Source, alert.Lock.Type, alert.Lock.Name, alert.Lock.ID)
+		current[key] = struct{}{}
+		if _, ok := a.alerted[key]; ok {
+			continue
+		}
+		analyze.PrintAlert(os.Stdout, alert)
+		a.alerts++
+		if a.failFast {
+			os.Exit(1)
+		}
+	}
+	a.alerted = current
+}
+
+// count returns the number of alerts printed.
+func (a *alerter) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.alerts
+}
@@ -1,16 +1,23 @@
 package deadlog
 
 import (
+	"container/list"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Event represents a lock operation for logging.
+// A TRACE event instead defines an interned stack, see InternTraces, and a
+// HEADER event identifies the process that wrote the log, see Header.
 type Event struct {
 	Type  string `json:"type"`            // "LOCK" or "RLOCK"
 	State string `json:"state"`           // "START", "ACQUIRED", or "RELEASED"
@@ -18,24 +25,276 @@ type Event struct {
 	ID    int    `json:"id"`              // correlation ID
 	Trace string `json:"trace,omitempty"` // optional stack trace
 	Ts    int64  `json:"ts"`              // unix nanoseconds
+
+	Frames []Frame `json:"frames,omitempty"` // optional structured stack trace
+
+	PCs     []uintptr `json:"pcs,omitempty"`      // optional raw program counters
+	BuildID string    `json:"build_id,omitempty"` // build ID of the binary the PCs belong to
+
+	TraceID int `json:"trace_id,omitempty"` // interned stack, defined by an earlier TRACE event
+
+	Goroutine int64 `json:"goroutine,omitempty"` // optional ID of the goroutine, see WithGoroutineID
+
+	Source string `json:"source,omitempty"` // optional process or file the event came from
+
+	Header *Header `json:"header,omitempty"` // process identity, only in HEADER events
+
+	// Prefix is the text before the event on its log line, such as a
+	// timestamp or pod name added by a log collector. It is filled in by
+	// the analyzer and never logged.
+	Prefix string `json:"-"`
+
+	// Package and Test identify the test that logged the event, when it was
+	// read from go test -json output. They are filled in by the analyzer and
+	// never logged.
+	Package string `json:"-"`
+	Test    string `json:"-"`
+}
+
+// Frame is a single fully-qualified stack frame.
+type Frame struct {
+	Func string `json:"func"` // fully-qualified function, e.g. "example.com/pkg.(*T).Method"
+	File string `json:"file"` // absolute source file path
+	Line int    `json:"line"` // line number within File
+}
+
+// String returns the frame as "func file:line".
+func (f Frame) String() string {
+	return fmt.Sprintf("%s %s:%d", f.Func, f.File, f.Line)
 }
 
 // LogFunc is a function that handles lock events.
 type LogFunc func(Event)
 
-// DefaultLogger writes JSON events to stdout.
+// FDEnv names the environment variable that redirects DefaultLogger to an
+// inherited file descriptor, as set by deadlog run.
+const FDEnv = "DEADLOG_FD"
+
+// defaultOutput returns where DefaultLogger writes. FDEnv is read when a
+// default logger is first used rather than when the package is initialized,
+// so that importing the package has no side effects.
+var defaultOutput = sync.OnceValue(outputFromEnv)
+
+// defaultHeader writes the HEADER event of DefaultLogger once per process.
+var defaultHeader sync.Once
+
+// outputFromEnv returns the file descriptor named by FDEnv, or stdout. Once
+// read, the variable is removed so that child processes started later, which
+// don't inherit the descriptor, don't write to whatever they have open under
+// that number.
+func outputFromEnv() io.Writer {
+	value, ok := os.LookupEnv(FDEnv)
+	if !ok {
+		return os.Stdout
+	}
+	os.Unsetenv(FDEnv)
+	if f := fdFile(value); f != nil {
+		return f
+	}
+	return os.Stdout
+}
+
+// fdFile returns the file for a descriptor number, or nil if it isn't one.
+func fdFile(value string) *os.File {
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < 0 {
+		return nil
+	}
+	return os.NewFile(uintptr(fd), FDEnv)
+}
+
+// DefaultLogger writes JSON events to stdout, preceded by a HEADER event.
+// When FDEnv names a file descriptor, events are written there instead, so
+// they don't mix with the program's own output.
 func DefaultLogger(e Event) {
-	_ = json.NewEncoder(os.Stdout).Encode(e)
+	defaultHeader.Do(func() {
+		_ = json.NewEncoder(defaultOutput()).Encode(headerBefore(e, nil))
+	})
+	_ = json.NewEncoder(defaultOutput()).Encode(e)
+}
+
+// NewDefaultLogger returns a LogFunc that writes JSON events where
+// DefaultLogger does, with options such as WithLabels or WithoutHeader. It
+// writes its own HEADER event.
+func NewDefaultLogger(opts ...LoggerOption) LogFunc {
+	return WriterLogger(defaultOutput(), opts...)
 }
 
-// WriterLogger returns a LogFunc that writes JSON events to the given writer.
-func WriterLogger(w io.Writer) LogFunc {
+// WriterLogger returns a LogFunc that writes JSON events to the given writer,
+// preceded by a HEADER event unless WithoutHeader is given.
+func WriterLogger(w io.Writer, opts ...LoggerOption) LogFunc {
+	var o loggerOpts
+	for _, opt := range opts {
+		opt(&o)
+	}
 	enc := json.NewEncoder(w)
+	var header sync.Once
 	return func(e Event) {
+		if !o.noHeader {
+			header.Do(func() {
+				_ = enc.Encode(headerBefore(e, o.labels))
+			})
+		}
 		_ = enc.Encode(e)
 	}
 }
 
+// headerBefore returns the HEADER event to log before e, with the same
+// timestamp so that merging logs by timestamp keeps it first.
+func headerBefore(e Event, labels map[string]string) Event {
+	h := HeaderEvent(NewHeader(labels))
+	h.Ts = e.Ts
+	return h
+}
+
+// maxInternedTraces is how many stacks InternTraces remembers.
+const maxInternedTraces = 4096
+
+// InternTraces returns a LogFunc that logs each distinct stack only once.
+// The first time a stack is seen, a TRACE event carrying the stack and a new
+// TraceID is logged; every event then carries only its TraceID. Share one
+// interning logger between mutexes that write to the same output.
+//
+// The 4096 most recently used stacks are remembered. A stack that was
+// forgotten is defined again under a new TraceID when it is next seen, so
+// memory stays bounded however many distinct stacks a process has.
+func InternTraces(next LogFunc) LogFunc {
+	return internTraces(next, maxInternedTraces)
+}
+
+// internTraces is InternTraces remembering at most max stacks.
+func internTraces(next LogFunc, max int) LogFunc {
+	type interned struct {
+		key string
+		id  int
+	}
+	var (
+		mu     sync.Mutex
+		ids    = make(map[string]*list.Element)
+		recent = list.New() // of interned, most recently used first
+		nextID = 1
+	)
+	return func(e Event) {
+		if e.Trace == "" && len(e.Frames) == 0 && len(e.PCs) == 0 {
+			next(e)
+			return
+		}
+		key := stackKey(e)
+
+		mu.Lock()
+		var id int
+		if el, ok := ids[key]; ok {
+			recent.MoveToFront(el)
+			id = el.Value.(interned).id
+		} else {
+			id = nextID
+			nextID++
+			// Log the definition before anyone can reference it.
+			next(Event{
+				Type:    "TRACE",
+				Trace:   e.Trace,
+				Frames:  e.Frames,
+				PCs:     e.PCs,
+				BuildID: e.BuildID,
+				TraceID: id,
+				Ts:      e.Ts,
+			})
+			ids[key] = recent.PushFront(interned{key, id})
+			if recent.Len() > max {
+				delete(ids, recent.Remove(recent.Back()).(interned).key)
+			}
+		}
+		mu.Unlock()
+
+		e.Trace, e.Frames, e.PCs, e.BuildID = "", nil, nil, ""
+		e.TraceID = id
+		next(e)
+	}
+}
+
+// liveTraces keeps the TRACE definitions that events may still reference,
+// for outputs that must repeat them, such as each connection of a
+// NetworkSink. Definitions are evicted when least recently used, as by
+// InternTraces, so that the set stays bounded.
+type liveTraces struct {
+	mu     sync.Mutex
+	max    int
+	byID   map[int]*liveTrace
+	recent list.List // of *liveTrace, most recently used first
+	order  list.List // of *liveTrace, oldest definition first
+	seq    int
+}
+
+type liveTrace struct {
+	seq    int
+	id     int
+	line   []byte
+	recent *list.Element
+	order  *list.Element
+}
+
+func newLiveTraces(max int) *liveTraces {
+	return &liveTraces{max: max, byID: make(map[int]*liveTrace)}
+}
+
+// observe records the definition carried by a TRACE event, or a use of the
+// definition an event references.
+func (t *liveTraces) observe(e Event, line []byte) {
+	if e.Type != "TRACE" && e.TraceID == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e.Type != "TRACE" {
+		if d, ok := t.byID[e.TraceID]; ok {
+			t.recent.MoveToFront(d.recent)
+		}
+		return
+	}
+	t.seq++
+	d := &liveTrace{seq: t.seq, id: e.TraceID, line: line}
+	d.recent = t.recent.PushFront(d)
+	d.order = t.order.PushBack(d)
+	t.byID[d.id] = d
+	if t.recent.Len() > t.max {
+		old := t.recent.Remove(t.recent.Back()).(*liveTrace)
+		t.order.Remove(old.order)
+		delete(t.byID, old.id)
+	}
+}
+
+// since returns the live definitions recorded after seq, oldest first, and
+// the seq to pass next time. A seq of 0 returns all of them.
+func (t *liveTraces) since(seq int) ([][]byte, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var lines [][]byte
+	for el := t.order.Back(); el != nil; el = el.Prev() {
+		d := el.Value.(*liveTrace)
+		if d.seq <= seq {
+			break
+		}
+		lines = append(lines, d.line)
+	}
+	slices.Reverse(lines)
+	return lines, t.seq
+}
+
+// stackKey identifies the stack carried by an event.
+func stackKey(e Event) string {
+	var b strings.Builder
+	b.WriteString(e.Trace)
+	for _, f := range e.Frames {
+		fmt.Fprintf(&b, "\x00%s", f)
+	}
+	b.WriteString("\x00")
+	b.WriteString(e.BuildID)
+	for _, pc := range e.PCs {
+		fmt.Fprintf(&b, "\x00%x", pc)
+	}
+	return b.String()
+}
+
 func newEvent(typ, state, name string, id int, trace string) Event {
 	return Event{
 		Type:  typ,
@@ -47,28 +306,84 @@ func newEvent(typ, state, name string, id int, trace string) Event {
 	}
 }
 
-func getCallerChain(skip, depth int) string {
+func getCallerPCs(skip, depth int) []uintptr {
 	if depth <= 0 {
-		return ""
+		return nil
 	}
 	pcs := make([]uintptr, depth)
 	n := runtime.Callers(skip, pcs)
+	return pcs[:n]
+}
+
+// helpers holds the names of functions marked with Helper.
+var (
+	helpers    sync.Map // map[string]struct{}
+	hasHelpers atomic.Bool
+)
+
+// maxHelperFrames bounds how many leading helper frames are skipped.
+const maxHelperFrames = 16
+
+// Helper marks the calling function as a locking helper. When attributing
+// lock events, leading helper frames are skipped so that events point at the
+// helper's caller, the same way testing.T.Helper works for test failures.
+// Helper may be called concurrently and on every call of the helper.
+func Helper() {
+	var pc [1]uintptr
+	if runtime.Callers(2, pc[:]) == 0 {
+		return
+	}
+	frame, _ := runtime.CallersFrames(pc[:]).Next()
+	if _, loaded := helpers.LoadOrStore(frame.Function, struct{}{}); !loaded {
+		hasHelpers.Store(true)
+	}
+}
+
+func isHelper(fn string) bool {
+	_, ok := helpers.Load(fn)
+	return ok
+}
+
+func getCallerFrames(skip, depth int) []Frame {
+	if depth <= 0 {
+		return nil
+	}
+	size := depth
+	checkHelpers := hasHelpers.Load()
+	if checkHelpers {
+		size += maxHelperFrames
+	}
+	pcs := make([]uintptr, size)
+	n := runtime.Callers(skip, pcs)
 	if n == 0 {
-		return ""
+		return nil
 	}
 	frames := runtime.CallersFrames(pcs[:n])
 
-	var parts []string
+	var out []Frame
 	for {
 		frame, more := frames.Next()
-		name := frame.Function
-		if idx := strings.LastIndex(name, "."); idx != -1 {
-			name = name[idx+1:]
+		if checkHelpers && len(out) == 0 && more && isHelper(frame.Function) {
+			continue
 		}
-		parts = append(parts, fmt.Sprintf("%s:%d", name, frame.Line))
-		if !more || len(parts) >= depth {
+		out = append(out, Frame{Func: frame.Function, File: frame.File, Line: frame.Line})
+		if !more || len(out) >= depth {
 			break
 		}
 	}
+	return out
+}
+
+// formatTrace renders frames in the legacy "fn:line <- fn:line" form,
+// keeping only the last dot-separated element of each function name.
+func formatTrace(frames []Frame) string {
+	parts := make([]string, 0, len(frames))
+	for _, f := range frames {
+		name := f.Func
+		if idx := strings.LastIndex(name, "."); idx != -1 {
+			name = name[idx+1:]
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d", name, f.Line))
+	}
 	return strings.Join(parts, " <- ")
 }
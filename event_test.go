@@ -0,0 +1,118 @@
+package deadlog
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestInternTraces(t *testing.T) {
+	var buf bytes.Buffer
+	logger := InternTraces(WriterLogger(&buf))
+	m := New(WithTrace(2), WithLogger(logger))
+
+	for i := 0; i < 2; i++ {
+		unlock := m.LockFunc()
+		unlock()
+	}
+
+	events := collectEvents(&buf)
+	var defs, refs int
+	traces := make(map[int]string)
+	for _, e := range events {
+		if e.Type == "TRACE" {
+			defs++
+			if e.Trace == "" || e.TraceID == 0 {
+				t.Errorf("TRACE definition should carry a trace and ID: %+v", e)
+			}
+			traces[e.TraceID] = e.Trace
+			continue
+		}
+		refs++
+		if e.Trace != "" {
+			t.Errorf("interned event should not repeat the trace: %q", e.Trace)
+		}
+		if _, ok := traces[e.TraceID]; !ok {
+			t.Errorf("event references undefined trace %d", e.TraceID)
+		}
+	}
+	if refs != 6 {
+		t.Errorf("expected 6 lock events, got %d", refs)
+	}
+	// START/ACQUIRED share a stack, RELEASED has its own (the unlock call).
+	if defs != 2 {
+		t.Errorf("expected 2 TRACE definitions, got %d", defs)
+	}
+}
+
+func TestInternTraces_Evicts(t *testing.T) {
+	var events []Event
+	logger := internTraces(func(e Event) { events = append(events, e) }, 2)
+	for _, trace := range []string{"a:1", "b:1", "a:1", "c:1", "b:1", "a:1"} {
+		logger(Event{Type: "LOCK", State: "START", Trace: trace})
+	}
+
+	var defs []string
+	ids := make(map[int]string)
+	for _, e := range events {
+		if e.Type == "TRACE" {
+			defs = append(defs, e.Trace)
+			ids[e.TraceID] = e.Trace
+		} else if ids[e.TraceID] == "" {
+			t.Errorf("event references undefined trace %d", e.TraceID)
+		}
+	}
+	// c evicts b, the least recently used; b then evicts a, and a evicts c,
+	// each being defined again.
+	if want := "a:1,b:1,c:1,b:1,a:1"; strings.Join(defs, ",") != want {
+		t.Errorf("expected definitions %s, got %v", want, defs)
+	}
+	if len(ids) != len(defs) {
+		t.Errorf("expected a new ID for each definition, got %v", ids)
+	}
+}
+
+func TestLiveTraces(t *testing.T) {
+	defs := newLiveTraces(2)
+	define := func(id int) {
+		defs.observe(Event{Type: "TRACE", TraceID: id}, []byte(strconv.Itoa(id)))
+	}
+	join := func(lines [][]byte) string {
+		return string(bytes.Join(lines, []byte(",")))
+	}
+
+	define(1)
+	define(2)
+	lines, seq := defs.since(0)
+	if join(lines) != "1,2" {
+		t.Errorf("expected definitions 1,2, got %s", join(lines))
+	}
+	// Using 1 makes 2 the least recently used, which 3 evicts.
+	defs.observe(Event{Type: "LOCK", TraceID: 1}, nil)
+	define(3)
+	if lines, _ := defs.since(seq); join(lines) != "3" {
+		t.Errorf("expected only the new definition 3, got %s", join(lines))
+	}
+	if lines, _ := defs.since(0); join(lines) != "1,3" {
+		t.Errorf("expected the live definitions 1,3 in order, got %s", join(lines))
+	}
+}
+
+func TestInternTraces_NoTrace(t *testing.T) {
+	var buf bytes.Buffer
+	m := New(WithLogger(InternTraces(WriterLogger(&buf))))
+
+	m.Lock()
+	m.Unlock()
+
+	events := collectEvents(&buf)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events and no TRACE definitions, got %d", len(events))
+	}
+	for _, e := range events {
+		if e.TraceID != 0 {
+			t.Errorf("expected no trace ID without a trace, got %d", e.TraceID)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+//go:build unix
+
+package deadlog
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestOutputFromEnv(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	// The logger takes ownership of the descriptor, so give it a copy.
+	fd, err := syscall.Dup(int(w.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(FDEnv, strconv.Itoa(fd))
+	out := outputFromEnv()
+	defer out.(*os.File).Close()
+	if _, ok := os.LookupEnv(FDEnv); ok {
+		t.Errorf("expected %s to be removed", FDEnv)
+	}
+	if _, err := io.WriteString(out, "hello\n"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != "hello\n" {
+		t.Errorf("expected output on the descriptor, got %q, %v", buf, err)
+	}
+
+	for _, value := range []string{"", "stdout", "-1"} {
+		t.Setenv(FDEnv, value)
+		if out := outputFromEnv(); out != os.Stdout {
+			t.Errorf("%q: expected stdout, got %v", value, out)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package deadlog
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGoroutineID(t *testing.T) {
+	ids := make(chan int64)
+	go func() {
+		ids <- goroutineID()
+	}()
+	mine, other := goroutineID(), <-ids
+	if mine == 0 || other == 0 || mine == other {
+		t.Fatalf("expected distinct nonzero IDs, got %d and %d", mine, other)
+	}
+
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	want := "goroutine " + strconv.FormatInt(mine, 10) + " ["
+	if !strings.HasPrefix(string(buf), want) {
+		t.Errorf("expected the stack to start with %q, got %q", want, buf)
+	}
+}
+
+func TestWithGoroutineID(t *testing.T) {
+	var events []Event
+	m := New(WithGoroutineID(), WithLogger(func(e Event) { events = append(events, e) }))
+	unlock := m.LockFunc()
+	unlock()
+	want := goroutineID()
+	for _, e := range events {
+		if e.Goroutine != want {
+			t.Errorf("%s: expected goroutine %d, got %d", e.State, want, e.Goroutine)
+		}
+	}
+
+	events = nil
+	New(WithLogger(func(e Event) { events = append(events, e) })).Lock()
+	if events[0].Goroutine != 0 {
+		t.Errorf("expected no goroutine ID by default, got %d", events[0].Goroutine)
+	}
+}
@@ -0,0 +1,101 @@
+package deadlog
+
+import (
+	"os"
+	"runtime"
+	"runtime/trace"
+	"time"
+)
+
+// SchemaVersion is the version of the event format, logged in headers.
+const SchemaVersion = 1
+
+// processStart approximates when the process started, to tell runs with a
+// reused PID apart.
+var processStart = time.Now()
+
+// Header identifies the process that wrote a log. Loggers write it in a
+// HEADER event before their first event, unless WithoutHeader is given, so
+// the analyzer can tell which process produced a log and where a restarted
+// process begins a new session.
+type Header struct {
+	Schema     int               `json:"schema"`               // SchemaVersion of the writer
+	PID        int               `json:"pid"`                  // process ID
+	Hostname   string            `json:"hostname,omitempty"`   // host the process ran on
+	Executable string            `json:"executable,omitempty"` // path of the binary
+	GoVersion  string            `json:"go_version"`           // runtime.Version() of the binary
+	BuildID    string            `json:"build_id,omitempty"`   // Go build ID of the binary
+	Start      int64             `json:"start"`                // unix nanoseconds the process started
+	Labels     map[string]string `json:"labels,omitempty"`     // optional user labels, see WithLabels
+}
+
+// NewHeader returns the header of the current process with the given labels.
+func NewHeader(labels map[string]string) *Header {
+	hostname, _ := os.Hostname()
+	executable, _ := os.Executable()
+	return &Header{
+		Schema:     SchemaVersion,
+		PID:        os.Getpid(),
+		Hostname:   hostname,
+		Executable: executable,
+		GoVersion:  runtime.Version(),
+		BuildID:    BuildID(),
+		Start:      processStart.UnixNano(),
+		Labels:     labels,
+	}
+}
+
+// SameProcess reports whether two headers were written by the same run of a
+// process, as loggers sharing an output each write their own header.
+func (h *Header) SameProcess(other *Header) bool {
+	return h.PID == other.PID && h.Hostname == other.Hostname && h.Start == other.Start
+}
+
+// HeaderEvent returns a HEADER event carrying h.
+func HeaderEvent(h *Header) Event {
+	return Event{Type: "HEADER", Ts: time.Now().UnixNano(), Header: h}
+}
+
+// loggerOpts holds options for WriterLogger, RotatingFile,
+// NetworkSink and state dumps.
+type loggerOpts struct {
+	labels   map[string]string
+	noHeader bool // ignored by NetworkSink
+
+	// Rotation, only used by RotatingFile.
+	maxSize  int64
+	maxAge   time.Duration
+	maxFiles int
+	compress bool
+
+	// Queueing, only used by NetworkSink.
+	bufferSize int
+
+	// State dumps, only used by WriteState and HandleSignal.
+	goroutines     bool
+	flightRecorder *trace.FlightRecorder
+	dumpDir        string
+}
+
+// LoggerOption configures a logger created by WriterLogger,
+// NewRotatingFile or NewNetworkSink, or a state dump.
+type LoggerOption func(*loggerOpts)
+
+// WithLabels adds user labels, such as a service or replica name, to the
+// logger's header.
+func WithLabels(labels map[string]string) LoggerOption {
+	return func(o *loggerOpts) {
+		o.labels = labels
+	}
+}
+
+// WithoutHeader disables the HEADER event that loggers and state dumps start
+// their output with, for outputs that are only read by other code. Without
+// it, the analyzer can't identify the process or tell restarts appended to
+// one log apart. NetworkSink always sends one, since the collector uses it
+// to identify the client.
+func WithoutHeader() LoggerOption {
+	return func(o *loggerOpts) {
+		o.noHeader = true
+	}
+}
@@ -0,0 +1,84 @@
+package deadlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func decodeAll(t *testing.T, buf *bytes.Buffer) []Event {
+	t.Helper()
+	var events []Event
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestWriterLogger_Header(t *testing.T) {
+	var buf bytes.Buffer
+	logger := WriterLogger(&buf, WithLabels(map[string]string{"replica": "2"}))
+	m := New(WithName("header-test"), WithLogger(logger))
+	unlock := m.LockFunc()
+	unlock()
+
+	events := decodeAll(t, &buf)
+	if len(events) != 4 {
+		t.Fatalf("expected a header and 3 events, got %d", len(events))
+	}
+	e := events[0]
+	if e.Type != "HEADER" || e.Header == nil {
+		t.Fatalf("expected a HEADER first, got %+v", e)
+	}
+	if e.Ts != events[1].Ts {
+		t.Errorf("expected the header to share the first event's timestamp")
+	}
+	h := e.Header
+	if h.Schema != SchemaVersion || h.PID != os.Getpid() || h.GoVersion != runtime.Version() {
+		t.Errorf("unexpected header: %+v", h)
+	}
+	if h.Executable == "" || h.Start == 0 {
+		t.Errorf("expected executable and start time, got %+v", h)
+	}
+	if h.Labels["replica"] != "2" {
+		t.Errorf("expected labels, got %v", h.Labels)
+	}
+	for _, e := range events[1:] {
+		if e.Header != nil {
+			t.Errorf("only the first event should carry a header: %+v", e)
+		}
+	}
+}
+
+func TestWriterLogger_WithoutHeader(t *testing.T) {
+	var buf bytes.Buffer
+	m := New(WithLogger(WriterLogger(&buf, WithoutHeader())))
+	m.Lock()
+	m.Unlock()
+
+	for _, e := range decodeAll(t, &buf) {
+		if e.Type == "HEADER" {
+			t.Error("expected no header")
+		}
+	}
+}
+
+func TestHeader_SameProcess(t *testing.T) {
+	a := NewHeader(nil)
+	b := NewHeader(map[string]string{"other": "logger"})
+	if !a.SameProcess(b) {
+		t.Error("headers of one process should match")
+	}
+	c := *a
+	c.PID++
+	if a.SameProcess(&c) {
+		t.Error("headers of different processes should not match")
+	}
+}
@@ -2,6 +2,7 @@ package deadlog
 
 import (
 	"math/rand/v2"
+	"runtime/trace"
 	"sync"
 )
 
@@ -12,6 +13,19 @@ type Mutex struct {
 	name       string
 	logFunc    LogFunc
 	traceDepth int
+	frameDepth int
+	pcDepth    int
+	callerSkip int
+
+	goroutineID bool
+
+	runtimeTrace bool
+	hold         *trace.Task // task of the current Lock, guarded by mu
+
+	profile   bool
+	held      *profileOp // profile entry of the current write hold, guarded by mu
+	readersMu sync.Mutex
+	readers   []reader // profile entries of RLock holds
 }
 
 // New creates a new logged Mutex with the given options.
@@ -25,28 +39,53 @@ func New(opts ...Option) *Mutex {
 	return m
 }
 
-func (m *Mutex) emit(typ, state string, id int, name string) {
+// emit logs an event attributed to the caller of the Mutex method,
+// skipping a further skip frames.
+func (m *Mutex) emit(typ, state string, id int, name string, skip int) {
+	m.traceLog(typ, state, id, name)
 	if m.logFunc == nil {
 		return
 	}
+	frames := getCallerFrames(4+skip, max(m.traceDepth, m.frameDepth))
 	trace := ""
 	if m.traceDepth > 0 {
-		trace = getCallerChain(4, m.traceDepth)
+		trace = formatTrace(frames[:min(len(frames), m.traceDepth)])
+	}
+	e := newEvent(typ, state, name, id, trace)
+	if m.frameDepth > 0 {
+		e.Frames = frames[:min(len(frames), m.frameDepth)]
+	}
+	if m.pcDepth > 0 {
+		e.PCs = getCallerPCs(4+skip, m.pcDepth)
+		e.BuildID = BuildID()
+	}
+	if m.goroutineID {
+		e.Goroutine = goroutineID()
 	}
-	m.logFunc(newEvent(typ, state, name, id, trace))
+	m.logFunc(e)
 }
 
 // Lock acquires the write lock.
 // Uses type "WLOCK" which does not track RELEASED (use LockFunc for that).
 func (m *Mutex) Lock() {
 	id := rand.IntN(9999999)
-	m.emit("WLOCK", "START", id, m.name)
+	m.emit("WLOCK", "START", id, m.name, m.callerSkip)
+	op := m.profileWait("WLOCK", m.name, id, m.callerSkip)
+	wait := m.startWait(m.name)
 	m.mu.Lock()
-	m.emit("WLOCK", "ACQUIRED", id, m.name)
+	endWait(wait)
+	profileAcquire(op, m.callerSkip)
+	m.emit("WLOCK", "ACQUIRED", id, m.name, m.callerSkip)
+	m.hold = m.startHold(m.name)
+	m.held = op
 }
 
 // Unlock releases the write lock.
 func (m *Mutex) Unlock() {
+	hold, op := m.hold, m.held
+	m.hold, m.held = nil, nil
+	endHold(hold)
+	profileRelease(op)
 	m.mu.Unlock()
 }
 
@@ -55,16 +94,28 @@ func (m *Mutex) Unlock() {
 // Uses type "LOCK" which tracks the full lifecycle.
 // Optional LockOpt arguments override per-call settings (e.g. WithLockName).
 func (m *Mutex) LockFunc(opts ...LockOpt) func() {
-	lo := lockOpts{name: m.name}
+	lo := lockOpts{name: m.name, callerSkip: m.callerSkip}
 	for _, opt := range opts {
 		opt(&lo)
 	}
 	id := rand.IntN(9999999)
-	m.emit("LOCK", "START", id, lo.name)
+	m.emit("LOCK", "START", id, lo.name, lo.callerSkip)
+	op := m.profileWait("LOCK", lo.name, id, lo.callerSkip)
+	wait := m.startWait(lo.name)
 	m.mu.Lock()
-	m.emit("LOCK", "ACQUIRED", id, lo.name)
+	endWait(wait)
+	profileAcquire(op, lo.callerSkip)
+	m.emit("LOCK", "ACQUIRED", id, lo.name, lo.callerSkip)
+	// Kept on the mutex too, so that Unlock releases them if it is called
+	// instead of the returned function.
+	m.hold = m.startHold(lo.name)
+	m.held = op
 	return func() {
-		m.emit("LOCK", "RELEASED", id, lo.name)
+		hold, op := m.hold, m.held
+		m.hold, m.held = nil, nil
+		endHold(hold)
+		profileRelease(op)
+		m.emit("LOCK", "RELEASED", id, lo.name, 0)
 		m.mu.Unlock()
 	}
 }
@@ -73,13 +124,19 @@ func (m *Mutex) LockFunc(opts ...LockOpt) func() {
 // Uses type "RWLOCK" which does not track RELEASED (use RLockFunc for that).
 func (m *Mutex) RLock() {
 	id := rand.IntN(9999999)
-	m.emit("RWLOCK", "START", id, m.name)
+	m.emit("RWLOCK", "START", id, m.name, m.callerSkip)
+	op := m.profileWait("RWLOCK", m.name, id, m.callerSkip)
+	wait := m.startWait(m.name)
 	m.mu.RLock()
-	m.emit("RWLOCK", "ACQUIRED", id, m.name)
+	endWait(wait)
+	profileAcquire(op, m.callerSkip)
+	m.pushReader(op)
+	m.emit("RWLOCK", "ACQUIRED", id, m.name, m.callerSkip)
 }
 
 // RUnlock releases the read lock.
 func (m *Mutex) RUnlock() {
+	profileRelease(m.popReader())
 	m.mu.RUnlock()
 }
 
@@ -88,16 +145,24 @@ func (m *Mutex) RUnlock() {
 // Uses type "RLOCK" which tracks the full lifecycle.
 // Optional LockOpt arguments override per-call settings (e.g. WithLockName).
 func (m *Mutex) RLockFunc(opts ...LockOpt) func() {
-	lo := lockOpts{name: m.name}
+	lo := lockOpts{name: m.name, callerSkip: m.callerSkip}
 	for _, opt := range opts {
 		opt(&lo)
 	}
 	id := rand.IntN(9999999)
-	m.emit("RLOCK", "START", id, lo.name)
+	m.emit("RLOCK", "START", id, lo.name, lo.callerSkip)
+	op := m.profileWait("RLOCK", lo.name, id, lo.callerSkip)
+	wait := m.startWait(lo.name)
 	m.mu.RLock()
-	m.emit("RLOCK", "ACQUIRED", id, lo.name)
+	endWait(wait)
+	profileAcquire(op, lo.callerSkip)
+	m.pushReader(op)
+	m.emit("RLOCK", "ACQUIRED", id, lo.name, lo.callerSkip)
+	hold := m.startHold(lo.name)
 	return func() {
-		m.emit("RLOCK", "RELEASED", id, lo.name)
+		endHold(hold)
+		profileRelease(m.takeReader(op))
+		m.emit("RLOCK", "RELEASED", id, lo.name, 0)
 		m.mu.RUnlock()
 	}
 }
@@ -3,12 +3,14 @@ package deadlog
 import (
 	"bytes"
 	"encoding/json"
+	"runtime"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 )
 
+// collectEvents decodes the lock events in buf, skipping the HEADER.
 func collectEvents(buf *bytes.Buffer) []Event {
 	var events []Event
 	dec := json.NewDecoder(buf)
@@ -17,6 +19,9 @@ func collectEvents(buf *bytes.Buffer) []Event {
 		if err := dec.Decode(&e); err != nil {
 			break
 		}
+		if e.Type == "HEADER" {
+			continue
+		}
 		events = append(events, e)
 	}
 	return events
@@ -311,3 +316,163 @@ func TestMutex_Timestamp(t *testing.T) {
 		}
 	}
 }
+
+func TestMutex_WithFrames(t *testing.T) {
+	var buf bytes.Buffer
+	m := New(WithFrames(2), WithLogger(WriterLogger(&buf)))
+
+	m.Lock()
+	m.Unlock()
+
+	events := collectEvents(&buf)
+	for _, e := range events {
+		if e.Trace != "" {
+			t.Errorf("expected no legacy trace without WithTrace, got %q", e.Trace)
+		}
+		if len(e.Frames) != 2 {
+			t.Fatalf("expected 2 frames, got %d", len(e.Frames))
+		}
+		f := e.Frames[0]
+		if f.Func != "github.com/stevenctl/deadlog.TestMutex_WithFrames" {
+			t.Errorf("expected fully-qualified caller, got %q", f.Func)
+		}
+		if !strings.HasSuffix(f.File, "mutex_test.go") {
+			t.Errorf("expected file mutex_test.go, got %q", f.File)
+		}
+		if f.Line == 0 {
+			t.Error("expected line number to be set")
+		}
+	}
+}
+
+func TestMutex_WithTraceAndFrames(t *testing.T) {
+	var buf bytes.Buffer
+	m := New(WithTrace(1), WithFrames(3), WithLogger(WriterLogger(&buf)))
+
+	unlock := m.LockFunc()
+	unlock()
+
+	events := collectEvents(&buf)
+	for _, e := range events {
+		if strings.Contains(e.Trace, " <- ") {
+			t.Errorf("expected a single-frame trace, got %q", e.Trace)
+		}
+		if !strings.HasPrefix(e.Trace, "TestMutex_WithTraceAndFrames:") {
+			t.Errorf("expected legacy trace to use the short name, got %q", e.Trace)
+		}
+		if len(e.Frames) < 2 {
+			t.Errorf("expected multiple frames, got %d", len(e.Frames))
+		}
+	}
+}
+
+// store wraps Mutex the way applications wrap it in their own helpers.
+type store struct {
+	mu *Mutex
+}
+
+func (s *store) lock() func() {
+	return s.mu.LockFunc()
+}
+
+func (s *store) lockSkipOne() func() {
+	return s.mu.LockFunc(WithLockCallerSkip(1))
+}
+
+func (s *store) lockHelper() func() {
+	Helper()
+	return s.mu.LockFunc()
+}
+
+func (s *store) lockNestedHelper() func() {
+	Helper()
+	return s.lockHelper()
+}
+
+func TestMutex_WithCallerSkip(t *testing.T) {
+	var buf bytes.Buffer
+	s := &store{mu: New(WithCallerSkip(1), WithFrames(1), WithLogger(WriterLogger(&buf)))}
+
+	unlock := s.lock()
+	unlock()
+
+	events := collectEvents(&buf)
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	for _, e := range events[:2] {
+		if e.Frames[0].Func != "github.com/stevenctl/deadlog.TestMutex_WithCallerSkip" {
+			t.Errorf("%s should be attributed to the wrapper's caller, got %q", e.State, e.Frames[0].Func)
+		}
+	}
+	// RELEASED is attributed to whoever calls unlock.
+	if events[2].Frames[0].Func != "github.com/stevenctl/deadlog.TestMutex_WithCallerSkip" {
+		t.Errorf("RELEASED should be attributed to the unlock caller, got %q", events[2].Frames[0].Func)
+	}
+}
+
+func TestMutex_WithoutCallerSkip(t *testing.T) {
+	var buf bytes.Buffer
+	s := &store{mu: New(WithFrames(1), WithLogger(WriterLogger(&buf)))}
+
+	unlock := s.lock()
+	unlock()
+
+	events := collectEvents(&buf)
+	if events[0].Frames[0].Func != "github.com/stevenctl/deadlog.(*store).lock" {
+		t.Errorf("expected START attributed to the wrapper, got %q", events[0].Frames[0].Func)
+	}
+}
+
+func TestMutex_WithLockCallerSkip(t *testing.T) {
+	var buf bytes.Buffer
+	s := &store{mu: New(WithTrace(1), WithLogger(WriterLogger(&buf)))}
+
+	unlock := s.lockSkipOne()
+	unlock()
+
+	events := collectEvents(&buf)
+	if !strings.HasPrefix(events[0].Trace, "TestMutex_WithLockCallerSkip:") {
+		t.Errorf("expected START attributed to the wrapper's caller, got %q", events[0].Trace)
+	}
+}
+
+func TestHelper(t *testing.T) {
+	var buf bytes.Buffer
+	s := &store{mu: New(WithFrames(1), WithLogger(WriterLogger(&buf)))}
+
+	unlock := s.lockNestedHelper()
+	unlock()
+
+	events := collectEvents(&buf)
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	for _, e := range events {
+		if e.Frames[0].Func != "github.com/stevenctl/deadlog.TestHelper" {
+			t.Errorf("%s should skip helper frames, got %q", e.State, e.Frames[0].Func)
+		}
+	}
+}
+
+func TestMutex_WithPCs(t *testing.T) {
+	var buf bytes.Buffer
+	m := New(WithPCs(2), WithLogger(WriterLogger(&buf)))
+
+	m.Lock()
+	m.Unlock()
+
+	events := collectEvents(&buf)
+	for _, e := range events {
+		if e.Trace != "" || len(e.Frames) != 0 {
+			t.Error("expected PCs mode not to symbolize")
+		}
+		if len(e.PCs) != 2 {
+			t.Fatalf("expected 2 PCs, got %d", len(e.PCs))
+		}
+		fn := runtime.FuncForPC(e.PCs[0] - 1)
+		if fn == nil || fn.Name() != "github.com/stevenctl/deadlog.TestMutex_WithPCs" {
+			t.Errorf("expected first PC in the test function, got %v", fn)
+		}
+	}
+}
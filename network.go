@@ -0,0 +1,236 @@
+package deadlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of NetworkSink.
+const (
+	defaultBufferSize = 4096
+	maxBatchSize      = 64 << 10
+	dialTimeout       = 5 * time.Second
+	writeTimeout      = 10 * time.Second
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 5 * time.Second
+)
+
+// NetworkSink streams events to a collector, such as deadlog collect, over
+// a TCP or unix socket connection. Events are queued and sent in the
+// background, so a slow or unreachable collector never blocks locking: when
+// the queue is full, events are dropped and counted. The connection is
+// re-established with backoff whenever it fails, and every connection
+// starts with a HEADER event so the collector can identify the process,
+// even with WithoutHeader.
+//
+// TRACE definitions written by InternTraces are never dropped, and the live
+// ones are sent again on every new connection, since the collector resolves
+// traces per connection. Like InternTraces, the sink forgets the least
+// recently used definitions, so their number stays bounded.
+//
+// Log only queues the event, so it can be passed to WithLogger of any number
+// of mutexes without slowing them down. Close sends what is still queued
+// and stops reconnecting.
+type NetworkSink struct {
+	network string
+	address string
+	opts    loggerOpts
+
+	queue   chan []byte
+	dropped atomic.Uint64
+
+	defs *liveTraces // TRACE definitions that queued events may reference
+
+	closeOnce sync.Once
+	done      chan struct{} // closed by Close
+	stopped   chan struct{} // closed when the sender exits
+}
+
+// WithBufferSize sets how many events a NetworkSink queues while waiting
+// to send them. The default is 4096.
+func WithBufferSize(n int) LoggerOption {
+	return func(o *loggerOpts) {
+		o.bufferSize = n
+	}
+}
+
+// NewNetworkSink returns a NetworkSink sending JSON events to address on the
+// named network, "tcp" or "unix", as accepted by net.Dial. It connects in
+// the background, so the collector doesn't have to be up yet.
+func NewNetworkSink(network, address string, opts ...LoggerOption) *NetworkSink {
+	s := &NetworkSink{
+		network: network,
+		address: address,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	size := s.opts.bufferSize
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+	s.queue = make(chan []byte, size)
+	// Queued events may still reference definitions InternTraces forgot.
+	s.defs = newLiveTraces(maxInternedTraces + size)
+	go s.run()
+	return s
+}
+
+// Log queues an event to be sent, or drops it if the queue is full or the
+// sink is closed. TRACE definitions are kept rather than queued.
+func (s *NetworkSink) Log(e Event) {
+	select {
+	case <-s.done:
+		s.dropped.Add(1)
+		return
+	default:
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		s.dropped.Add(1)
+		return
+	}
+	line = append(line, '\n')
+	s.defs.observe(e, line)
+	if e.Type == "TRACE" {
+		return
+	}
+	select {
+	case s.queue <- line:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of events that were dropped because the queue
+// was full, or that couldn't be sent before Close.
+func (s *NetworkSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close sends the queued events if connected, and stops the sink. Events
+// that can't be sent are counted as dropped.
+func (s *NetworkSink) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	<-s.stopped
+	return nil
+}
+
+// run connects and sends events until the sink is closed.
+func (s *NetworkSink) run() {
+	defer close(s.stopped)
+	var (
+		pending []byte // a batch that failed to send, resent after reconnecting
+		count   int    // events in pending
+		delay   = minReconnectDelay
+	)
+	for {
+		d := net.Dialer{Timeout: dialTimeout}
+		conn, err := d.Dial(s.network, s.address)
+		if err == nil {
+			delay = minReconnectDelay
+			pending, count, err = s.send(conn, pending, count)
+			conn.Close()
+			if err == nil {
+				return
+			}
+		}
+		select {
+		case <-s.done:
+			s.dropped.Add(uint64(count + len(s.queue)))
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// send writes the header, then pending, then queued events to conn until
+// the sink is closed, preceded by the TRACE definitions not yet sent on
+// conn. It returns nil once the queue is flushed after Close, or the events
+// that failed to send, their number, and the error.
+func (s *NetworkSink) send(conn net.Conn, pending []byte, count int) ([]byte, int, error) {
+	h, err := json.Marshal(HeaderEvent(NewHeader(s.opts.labels)))
+	if err == nil {
+		_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := conn.Write(append(h, '\n')); err != nil {
+			return pending, count, err
+		}
+	}
+
+	// Definitions are logged before the events referencing them are queued,
+	// so sending the new ones before each batch keeps them first.
+	sent := 0
+	sendDefs := func() error {
+		lines, seq := s.defs.since(sent)
+		if len(lines) > 0 {
+			defs := net.Buffers(lines)
+			_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if _, err := defs.WriteTo(conn); err != nil {
+				return err
+			}
+		}
+		sent = seq
+		return nil
+	}
+
+	batch := pending
+	for {
+		closing := false
+		if len(batch) == 0 {
+			select {
+			case line := <-s.queue:
+				batch = append(batch, line...)
+				count++
+			case <-s.done:
+				closing = true
+			}
+		}
+		// Batch whatever else is already queued.
+	fill:
+		for len(batch) < maxBatchSize {
+			select {
+			case line := <-s.queue:
+				batch = append(batch, line...)
+				count++
+			default:
+				break fill
+			}
+		}
+		if len(batch) > 0 {
+			if err := sendDefs(); err != nil {
+				return batch, count, err
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			n, err := conn.Write(batch)
+			if err != nil {
+				rest := s.unsent(batch, n)
+				return rest, bytes.Count(rest, []byte("\n")), err
+			}
+			batch, count = nil, 0
+		}
+		if closing && len(s.queue) == 0 {
+			return nil, 0, nil
+		}
+	}
+}
+
+// unsent returns the events of batch after the first n bytes were written.
+// An event that was cut off is dropped rather than resent, since the
+// collector already has its start.
+func (s *NetworkSink) unsent(batch []byte, n int) []byte {
+	if n == 0 || batch[n-1] == '\n' {
+		return batch[n:]
+	}
+	rest := batch[n:]
+	s.dropped.Add(1)
+	return rest[bytes.IndexByte(rest, '\n')+1:]
+}
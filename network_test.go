@@ -0,0 +1,175 @@
+package deadlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+// readEvents reads n events from conn.
+func readEvents(t *testing.T, r *bufio.Reader, n int) []Event {
+	t.Helper()
+	var events []Event
+	for range n {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("reading event %d: %v", len(events)+1, err)
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func accept(t *testing.T, l net.Listener) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+func TestNewNetworkSink(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := NewNetworkSink("tcp", l.Addr().String(), WithLabels(map[string]string{"app": "test"}))
+	defer s.Close()
+	log := InternTraces(s.Log)
+
+	log(Event{Type: "LOCK", State: "START", Name: "a", ID: 1, Trace: "f:1"})
+	conn, r := accept(t, l)
+	events := readEvents(t, r, 3)
+	if events[0].Type != "HEADER" || events[0].Header.Labels["app"] != "test" {
+		t.Errorf("expected a labelled header first, got %+v", events[0])
+	}
+	if events[1].Type != "TRACE" || events[1].TraceID != 1 {
+		t.Errorf("expected the trace definition, got %+v", events[1])
+	}
+	if events[2].ID != 1 || events[2].TraceID != 1 {
+		t.Errorf("expected event 1 referencing trace 1, got %+v", events[2])
+	}
+
+	// Drop the connection. Writes only fail once the peer has reset it, so
+	// keep logging until the sink reconnects and sends a new header.
+	conn.Close()
+	stop := make(chan struct{})
+	go func() {
+		for id := 2; ; id++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				log(Event{Type: "LOCK", State: "START", Name: "a", ID: id, Trace: "f:1"})
+			}
+		}
+	}()
+	l.(*net.TCPListener).SetDeadline(time.Now().Add(10 * time.Second))
+	conn, r = accept(t, l)
+	close(stop)
+	defer conn.Close()
+	// The new connection can't resolve the old one's definitions.
+	events = readEvents(t, r, 3)
+	if events[0].Type != "HEADER" {
+		t.Errorf("expected a header on the new connection, got %+v", events[0])
+	}
+	if events[1].Type != "TRACE" || events[1].Trace != "f:1" {
+		t.Errorf("expected the trace definition to be sent again, got %+v", events[1])
+	}
+	if events[2].Type != "LOCK" || events[2].TraceID != 1 {
+		t.Errorf("expected an event referencing it, got %+v", events[2])
+	}
+}
+
+func TestNetworkSink_Dropped(t *testing.T) {
+	// Nothing listens on a closed listener's address.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	s := NewNetworkSink("tcp", addr, WithBufferSize(2))
+	for id := range 5 {
+		s.Log(Event{Type: "LOCK", State: "START", ID: id})
+	}
+	if got := s.Dropped(); got != 3 {
+		t.Errorf("expected 3 events dropped by the full queue, got %d", got)
+	}
+	// Definitions don't take space in the queue.
+	s.Log(Event{Type: "TRACE", TraceID: 1, Trace: "f:1"})
+	if got := s.Dropped(); got != 3 {
+		t.Errorf("expected the trace definition to be kept, got %d dropped", got)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Dropped(); got != 5 {
+		t.Errorf("expected all 5 events dropped after Close, got %d", got)
+	}
+	s.Log(Event{Type: "LOCK", State: "START", ID: 6})
+	if got := s.Dropped(); got != 6 {
+		t.Errorf("expected events after Close to be dropped, got %d", got)
+	}
+}
+
+func TestNetworkSink_CloseFlushes(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// The header is sent even WithoutHeader, for the collector.
+	s := NewNetworkSink("tcp", l.Addr().String(), WithoutHeader())
+	conn, r := accept(t, l)
+	defer conn.Close()
+	for id := range 100 {
+		s.Log(Event{Type: "LOCK", State: "START", ID: id})
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	events := readEvents(t, r, 101)
+	if events[0].Type != "HEADER" {
+		t.Errorf("expected a header first, got %+v", events[0])
+	}
+	if events[100].ID != 99 || s.Dropped() != 0 {
+		t.Errorf("expected all events sent in order, last %+v, dropped %d", events[100], s.Dropped())
+	}
+}
+
+func TestNetworkSink_Unsent(t *testing.T) {
+	s := &NetworkSink{}
+	batch := []byte("a\nbb\ncc\n")
+	for _, tt := range []struct {
+		n       int
+		want    string
+		dropped uint64
+	}{
+		{0, "a\nbb\ncc\n", 0},
+		{2, "bb\ncc\n", 0},
+		// bb was cut off, so the collector has a partial line of it.
+		{3, "cc\n", 1},
+		{7, "", 2},
+		{8, "", 2},
+	} {
+		if got := s.unsent(batch, tt.n); string(got) != tt.want {
+			t.Errorf("%d bytes written: expected %q left, got %q", tt.n, tt.want, got)
+		}
+		if s.Dropped() != tt.dropped {
+			t.Errorf("%d bytes written: expected %d dropped, got %d", tt.n, tt.dropped, s.Dropped())
+		}
+	}
+}
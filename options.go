@@ -26,9 +26,78 @@ func WithTrace(depth int) Option {
 	}
 }
 
+// WithFrames enables structured stack frames with the specified depth.
+// Unlike WithTrace, each frame keeps the fully-qualified function name and
+// source file, and is logged in Event.Frames. A depth of 0 disables frames (default).
+func WithFrames(depth int) Option {
+	return func(m *Mutex) {
+		m.frameDepth = depth
+	}
+}
+
+// WithPCs enables logging of raw program counters with the specified depth.
+// This is much cheaper than WithTrace or WithFrames since nothing is
+// symbolized at runtime; the analyzer symbolizes Event.PCs offline given the
+// binary that produced them. Helper frames are not skipped in this mode.
+// A depth of 0 disables PCs (default).
+func WithPCs(depth int) Option {
+	return func(m *Mutex) {
+		m.pcDepth = depth
+	}
+}
+
+// WithCallerSkip skips n additional stack frames when attributing lock
+// acquisitions, for code that wraps Mutex in its own locking helpers.
+// A skip of 1 attributes START and ACQUIRED to the caller of the wrapper.
+// RELEASED is attributed to whoever calls the unlock function; wrappers that
+// call it on behalf of their caller can use Helper instead.
+func WithCallerSkip(n int) Option {
+	return func(m *Mutex) {
+		m.callerSkip = n
+	}
+}
+
+// WithRuntimeTrace records lock activity in runtime/trace execution traces,
+// so go tool trace shows which goroutine waited on which named lock. Waits
+// are wrapped in a "deadlog.wait <name>" region and holds are recorded as a
+// "deadlog.hold <name>" task, where name is the WithLockName callsite if
+// set; tasks rather than regions since locks may be released on another
+// goroutine. Every event is also logged under the "deadlog" category. Read
+// holds taken with RLock have no task since RUnlock can't tell them apart.
+// It costs nothing while no trace is being collected.
+func WithRuntimeTrace() Option {
+	return func(m *Mutex) {
+		m.runtimeTrace = true
+	}
+}
+
+// WithProfile adds outstanding operations to the "deadlog.waiting" and
+// "deadlog.held" pprof profiles, with the stack that started or acquired
+// them, so net/http/pprof and go tool pprof can show leaked locks in a live
+// process. RUnlock releases the most recent RLock hold of the calling
+// goroutine, or the most recent hold if it has none, since a read lock may
+// be released by another goroutine; use RLockFunc for exact stacks. Unlock
+// also releases a hold taken with LockFunc.
+func WithProfile() Option {
+	profiles() // register the profiles before they are first requested
+	return func(m *Mutex) {
+		m.profile = true
+	}
+}
+
+// WithGoroutineID logs the ID of the goroutine of each operation, so the
+// analyzer can match stuck operations to goroutine dumps. Getting the ID
+// costs a short stack walk per event.
+func WithGoroutineID() Option {
+	return func(m *Mutex) {
+		m.goroutineID = true
+	}
+}
+
 // lockOpts holds per-call options for LockFunc/RLockFunc.
 type lockOpts struct {
-	name string
+	name       string
+	callerSkip int
 }
 
 // LockOpt configures a single LockFunc or RLockFunc call.
@@ -41,3 +110,11 @@ func WithLockName(name string) LockOpt {
 		o.name = name
 	}
 }
+
+// WithLockCallerSkip sets the number of additional stack frames to skip for
+// this specific lock operation, overriding the mutex-level WithCallerSkip.
+func WithLockCallerSkip(n int) LockOpt {
+	return func(o *lockOpts) {
+		o.callerSkip = n
+	}
+}
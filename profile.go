@@ -0,0 +1,193 @@
+package deadlog
+
+import (
+	"runtime/pprof"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the pprof profiles maintained for mutexes created WithProfile.
+const (
+	HeldProfile    = "deadlog.held"
+	WaitingProfile = "deadlog.waiting"
+)
+
+// profiles registers the deadlog profiles on first use, since
+// pprof.NewProfile panics if a name is registered twice.
+var profiles = sync.OnceValues(func() (held, waiting *pprof.Profile) {
+	return pprof.NewProfile(HeldProfile), pprof.NewProfile(WaitingProfile)
+})
+
+// profileOp is the profile and state entry of one lock operation.
+type profileOp struct {
+	typ  string
+	name string
+	id   int
+
+	profiled bool // in the pprof profiles, see WithProfile
+	tracked  bool // in outstanding, see TrackState
+
+	// Kept for WriteState, guarded by outstanding.mu.
+	start     int64     // unix nanoseconds of START
+	acquired  int64     // unix nanoseconds of ACQUIRED, 0 while waiting
+	pcs       []uintptr // stack of the caller at START
+	goroutine int64     // goroutine ID if logged WithGoroutineID
+}
+
+// stateDepth is how many frames of an operation's stack WriteState reports.
+const stateDepth = 32
+
+// stateTracking counts the active TrackState calls, including those of
+// HandleSignal. Operations of all mutexes are tracked while it is positive.
+var stateTracking atomic.Int32
+
+// outstanding holds the operations tracked for WriteState, since a
+// pprof.Profile can't be read back.
+var outstanding = struct {
+	mu  sync.Mutex
+	ops map[*profileOp]struct{}
+}{ops: make(map[*profileOp]struct{})}
+
+// TrackState keeps track of the operations of all mutexes started from now
+// on, whether created WithProfile or not, until stop is called, so that
+// WriteState can report them. HandleSignal does this while it is handling
+// the signal; call it directly to use WriteState on its own, such as from a
+// debug endpoint. Tracking costs a stack walk and a global map update per
+// operation.
+func TrackState() (stop func()) {
+	stateTracking.Add(1)
+	return sync.OnceFunc(func() {
+		stateTracking.Add(-1)
+	})
+}
+
+// profileWait adds an operation to the waiting profile if the mutex was
+// created WithProfile, and to outstanding if the state is tracked, recording
+// the stack of the caller of the Mutex method, skipping a further skip
+// frames. It returns nil if neither is enabled.
+func (m *Mutex) profileWait(typ, name string, id, skip int) *profileOp {
+	tracked := stateTracking.Load() > 0
+	if !m.profile && !tracked {
+		return nil
+	}
+	op := &profileOp{typ: typ, name: name, id: id, profiled: m.profile, tracked: tracked}
+	if m.profile {
+		_, waiting := profiles()
+		waiting.Add(op, 2+skip)
+	}
+	if !tracked {
+		return op
+	}
+	op.pcs = getCallerPCs(4+skip, stateDepth)
+	if m.goroutineID {
+		op.goroutine = goroutineID()
+	}
+
+	outstanding.mu.Lock()
+	op.start = time.Now().UnixNano()
+	outstanding.ops[op] = struct{}{}
+	outstanding.mu.Unlock()
+	return op
+}
+
+// profileAcquire moves an operation from the waiting to the held profile.
+func profileAcquire(op *profileOp, skip int) {
+	if op == nil {
+		return
+	}
+	if op.profiled {
+		held, waiting := profiles()
+		waiting.Remove(op)
+		held.Add(op, 2+skip)
+	}
+	if op.tracked {
+		outstanding.mu.Lock()
+		op.acquired = time.Now().UnixNano()
+		outstanding.mu.Unlock()
+	}
+}
+
+// profileRelease removes an operation from the held profile.
+func profileRelease(op *profileOp) {
+	if op == nil {
+		return
+	}
+	if op.profiled {
+		held, _ := profiles()
+		held.Remove(op)
+	}
+	if op.tracked {
+		outstanding.mu.Lock()
+		delete(outstanding.ops, op)
+		outstanding.mu.Unlock()
+	}
+}
+
+// reader is the profile entry of an RLock hold and the goroutine that took
+// it.
+type reader struct {
+	goroutine int64
+	op        *profileOp
+}
+
+// pushReader records a read hold taken with RLock or RLockFunc.
+func (m *Mutex) pushReader(op *profileOp) {
+	if op == nil {
+		return
+	}
+	r := reader{goroutine: goroutineID(), op: op}
+	m.readersMu.Lock()
+	m.readers = append(m.readers, r)
+	m.readersMu.Unlock()
+}
+
+// popReader returns the read hold to release for RUnlock: the most recent
+// one taken by the calling goroutine. A goroutine may release a read lock
+// taken by another, so without one of its own, the most recent hold is
+// released instead; the number of held read locks stays accurate.
+func (m *Mutex) popReader() *profileOp {
+	m.readersMu.Lock()
+	n := len(m.readers)
+	m.readersMu.Unlock()
+	if n == 0 {
+		return nil
+	}
+	g := goroutineID()
+
+	m.readersMu.Lock()
+	defer m.readersMu.Unlock()
+	if len(m.readers) == 0 {
+		return nil
+	}
+	i := len(m.readers) - 1
+	for j := i; j >= 0; j-- {
+		if m.readers[j].goroutine == g {
+			i = j
+			break
+		}
+	}
+	op := m.readers[i].op
+	m.readers = slices.Delete(m.readers, i, i+1)
+	return op
+}
+
+// takeReader returns the read hold to release for the function returned by
+// RLockFunc: its own op, unless an RUnlock released that already, in which
+// case another hold is released in its place as by popReader.
+func (m *Mutex) takeReader(op *profileOp) *profileOp {
+	if op == nil {
+		return nil
+	}
+	m.readersMu.Lock()
+	i := slices.IndexFunc(m.readers, func(r reader) bool { return r.op == op })
+	if i >= 0 {
+		m.readers = slices.Delete(m.readers, i, i+1)
+	}
+	m.readersMu.Unlock()
+	if i < 0 {
+		return m.popReader()
+	}
+	return op
+}
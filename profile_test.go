@@ -0,0 +1,138 @@
+package deadlog
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func profileCount(t *testing.T, name string) int {
+	t.Helper()
+	p := pprof.Lookup(name)
+	if p == nil {
+		t.Fatalf("profile %s is not registered", name)
+	}
+	return p.Count()
+}
+
+func TestMutex_WithProfile(t *testing.T) {
+	m := New(WithName("profiled"), WithLogger(func(Event) {}), WithProfile())
+
+	unlock := m.LockFunc()
+	if n := profileCount(t, HeldProfile); n != 1 {
+		t.Fatalf("expected 1 held lock, got %d", n)
+	}
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup(HeldProfile).WriteTo(&buf, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "TestMutex_WithProfile") {
+		t.Errorf("held profile should contain the acquiring function:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "profileAcquire") {
+		t.Errorf("held profile should start at the caller of LockFunc:\n%s", buf.String())
+	}
+
+	// A second locker waits until the first releases.
+	done := make(chan struct{})
+	go func() {
+		m.Lock()
+		m.Unlock()
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for profileCount(t, WaitingProfile) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("waiter never appeared in the waiting profile")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	unlock()
+	<-done
+	if n := profileCount(t, WaitingProfile); n != 0 {
+		t.Errorf("expected no waiting locks, got %d", n)
+	}
+	if n := profileCount(t, HeldProfile); n != 0 {
+		t.Errorf("expected no held locks, got %d", n)
+	}
+}
+
+func TestMutex_WithProfile_Readers(t *testing.T) {
+	m := New(WithLogger(func(Event) {}), WithProfile())
+
+	m.RLock()
+	m.RLock()
+	runlock := m.RLockFunc()
+	if n := profileCount(t, HeldProfile); n != 3 {
+		t.Fatalf("expected 3 held read locks, got %d", n)
+	}
+	m.RUnlock()
+	runlock()
+	if n := profileCount(t, HeldProfile); n != 1 {
+		t.Fatalf("expected 1 held read lock, got %d", n)
+	}
+	m.RUnlock()
+	if n := profileCount(t, HeldProfile); n != 0 {
+		t.Errorf("expected no held locks, got %d", n)
+	}
+}
+
+func TestMutex_WithProfile_LockFuncUnlock(t *testing.T) {
+	defer TrackState()()
+	m := New(WithName("lockfunc-unlock"), WithLogger(func(Event) {}), WithProfile())
+
+	// Releasing a LockFunc hold with Unlock must not leak its entries.
+	_ = m.LockFunc()
+	m.Unlock()
+	if n := profileCount(t, HeldProfile); n != 0 {
+		t.Errorf("expected no held locks, got %d", n)
+	}
+	waitOutstanding(t, "lockfunc-unlock", 0)
+}
+
+func TestMutex_WithProfile_ReaderGoroutines(t *testing.T) {
+	m := New(WithLogger(func(Event) {}), WithProfile())
+
+	m.RLock()
+	other := make(chan int64)
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.RLock()
+		other <- goroutineID()
+		<-release
+		m.RUnlock()
+	}()
+	g := <-other
+
+	// The most recent hold is the other goroutine's, but RUnlock releases
+	// the caller's own.
+	m.RUnlock()
+	m.readersMu.Lock()
+	readers := slices.Clone(m.readers)
+	m.readersMu.Unlock()
+	if len(readers) != 1 || readers[0].goroutine != g {
+		t.Errorf("expected only the hold of goroutine %d left, got %+v", g, readers)
+	}
+	close(release)
+	<-done
+	if n := profileCount(t, HeldProfile); n != 0 {
+		t.Errorf("expected no held locks, got %d", n)
+	}
+
+	// An RUnlock releasing an RLockFunc hold leaves the returned function
+	// another hold to release.
+	runlock := m.RLockFunc()
+	m.RUnlock()
+	m.RLock()
+	runlock()
+	if n := profileCount(t, HeldProfile); n != 0 {
+		t.Errorf("expected no held locks, got %d", n)
+	}
+}
@@ -0,0 +1,331 @@
+package deadlog
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotatingFile is a log file that is rotated once it grows past a size or
+// age, so deadlog can stay enabled in long-running services. Rotated files
+// are named like logrotate names them, path.1 being the newest, and with a
+// .gz suffix when compressed, so the analyzer reads a whole set in order.
+// Every file starts with a HEADER event, followed by the TRACE definitions
+// of InternTraces that later events may still reference, so each file can be
+// read on its own after older ones were removed.
+//
+// Mutexes share a RotatingFile by passing its Log method to WithLogger;
+// writes from several goroutines are serialized and never interleave.
+// Close the file when the program is done logging.
+type RotatingFile struct {
+	path string
+	opts loggerOpts
+
+	defs *liveTraces // TRACE definitions to repeat in each new file
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64     // bytes in file
+	opened   time.Time // when file was started, for WithMaxAge
+	started  bool      // whether this process wrote the preamble to file
+	closed   bool
+	compress sync.WaitGroup // compression of the last rotated file
+}
+
+// WithMaxSize rotates a RotatingFile before a write would make the
+// file larger than size bytes.
+func WithMaxSize(size int64) LoggerOption {
+	return func(o *loggerOpts) {
+		o.maxSize = size
+	}
+}
+
+// WithMaxAge rotates a RotatingFile at the first write once the file
+// is older than age.
+func WithMaxAge(age time.Duration) LoggerOption {
+	return func(o *loggerOpts) {
+		o.maxAge = age
+	}
+}
+
+// WithMaxFiles keeps at most n rotated files of a RotatingFile,
+// removing older ones. By default all rotated files are kept.
+func WithMaxFiles(n int) LoggerOption {
+	return func(o *loggerOpts) {
+		o.maxFiles = n
+	}
+}
+
+// WithCompress gzips the files rotated by a RotatingFile. Compression
+// runs in the background so logging isn't blocked by it.
+func WithCompress() LoggerOption {
+	return func(o *loggerOpts) {
+		o.compress = true
+	}
+}
+
+// NewRotatingFile opens path for appending, creating it if needed, and
+// returns a RotatingFile writing JSON events to it. Rotation is configured
+// with WithMaxSize, WithMaxAge, WithMaxFiles and WithCompress; without a size
+// or age the file only rotates when Rotate is called.
+func NewRotatingFile(path string, opts ...LoggerOption) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, defs: newLiveTraces(maxInternedTraces)}
+	for _, opt := range opts {
+		opt(&f.opts)
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Log writes an event, rotating the file first if writing it would exceed
+// the maximum size or the file is older than the maximum age. Events are
+// dropped while the file can't be written.
+func (f *RotatingFile) Log(e Event) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+	// Observed last, so that a preamble written for e doesn't define it twice.
+	defer f.defs.observe(e, line)
+
+	pre := f.preamble(e)
+	if f.file == nil || f.due(e, int64(len(pre)+len(line))) {
+		if err := f.rotate(); err != nil {
+			return
+		}
+		pre = f.preamble(e)
+	}
+	if !f.started {
+		n, _ := f.file.Write(pre)
+		f.size += int64(n)
+		f.started = true
+	}
+	n, _ := f.file.Write(line)
+	f.size += int64(n)
+}
+
+// preamble returns what must be written before e to a file this process
+// hasn't written to yet: the header and the live TRACE definitions. It
+// returns nil once they were written. f.mu must be held.
+func (f *RotatingFile) preamble(e Event) []byte {
+	if f.started {
+		return nil
+	}
+	var pre []byte
+	if !f.opts.noHeader {
+		if h, err := json.Marshal(headerBefore(e, f.opts.labels)); err == nil {
+			pre = append(h, '\n')
+		}
+	}
+	defs, _ := f.defs.since(0)
+	for _, line := range defs {
+		pre = append(pre, line...)
+	}
+	return pre
+}
+
+// due reports whether the file must be rotated before writing n more bytes.
+// f.mu must be held.
+func (f *RotatingFile) due(e Event, n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.opts.maxSize > 0 && f.size+n > f.opts.maxSize {
+		return true
+	}
+	return f.opts.maxAge > 0 && time.Unix(0, e.Ts).Sub(f.opened) >= f.opts.maxAge
+}
+
+// Rotate closes the current file, shifts it to path.1, and starts a new one.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// rotate shifts the rotated files up one generation and opens a new file.
+// If the current file couldn't be opened, it only retries opening it.
+// f.mu must be held.
+func (f *RotatingFile) rotate() error {
+	if f.file == nil {
+		return f.open()
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	// A previous compression may still be reading path.1.
+	f.compress.Wait()
+
+	gens, err := f.generations()
+	if err != nil {
+		return err
+	}
+	for i := len(gens) - 1; i >= 0; i-- {
+		old := gens[i]
+		if f.opts.maxFiles > 0 && old.gen >= f.opts.maxFiles {
+			if err := os.Remove(old.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+		if err := os.Rename(old.path, f.rotatedName(old.gen+1, old.gz)); err != nil {
+			return err
+		}
+	}
+	first := f.rotatedName(1, false)
+	if err := os.Rename(f.path, first); err != nil {
+		return err
+	}
+	if f.opts.compress {
+		f.compress.Add(1)
+		go func() {
+			defer f.compress.Done()
+			_ = compressFile(first)
+		}()
+	}
+	return f.open()
+}
+
+// open starts writing to path. f.mu must be held, or f not yet shared.
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	if f.size > 0 {
+		f.opened = startTime(f.path, info)
+	}
+	f.started = false
+	return nil
+}
+
+// startTime returns when the existing file at path was started: the
+// timestamp of its first event, or its modification time if that can't be
+// read.
+func startTime(path string, info os.FileInfo) time.Time {
+	if r, err := os.Open(path); err == nil {
+		defer r.Close()
+		var e Event
+		if json.NewDecoder(r).Decode(&e) == nil && e.Ts != 0 {
+			return time.Unix(0, e.Ts)
+		}
+	}
+	return info.ModTime()
+}
+
+// rotatedName returns the name of generation gen.
+func (f *RotatingFile) rotatedName(gen int, gz bool) string {
+	name := f.path + "." + strconv.Itoa(gen)
+	if gz {
+		name += ".gz"
+	}
+	return name
+}
+
+// generation is an existing rotated file.
+type generation struct {
+	path string
+	gen  int
+	gz   bool
+}
+
+// generations returns the existing rotated files, oldest last.
+func (f *RotatingFile) generations() ([]generation, error) {
+	dir, base := filepath.Split(f.path)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var gens []generation
+	for _, entry := range entries {
+		rest, ok := strings.CutPrefix(entry.Name(), base+".")
+		if !ok {
+			continue
+		}
+		suffix, gz := strings.CutSuffix(rest, ".gz")
+		gen, err := strconv.Atoi(suffix)
+		if err != nil || gen < 1 {
+			continue
+		}
+		gens = append(gens, generation{path: f.path + "." + rest, gen: gen, gz: gz})
+	}
+	slices.SortFunc(gens, func(a, b generation) int { return a.gen - b.gen })
+	return gens, nil
+}
+
+// compressFile gzips path to path.gz and removes path.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Close closes the file, waiting for a rotated file being compressed.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.compress.Wait()
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,214 @@
+package deadlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// readLog reads the events of a possibly gzipped log file.
+func readLog(t *testing.T, path string) []Event {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(path) == ".gz" {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err = io.ReadAll(gz); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return decodeAll(t, bytes.NewBuffer(data))
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestRotatingFile_Size(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	f, err := NewRotatingFile(path, WithMaxSize(1), WithMaxFiles(2), WithCompress(), WithLabels(map[string]string{"app": "test"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every event overflows the limit, so each file gets one event.
+	for id := 1; id <= 4; id++ {
+		f.Log(Event{Type: "LOCK", State: "START", Name: "a", ID: id, Ts: time.Now().UnixNano()})
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"app.log", "app.log.1.gz", "app.log.2.gz"}
+	if got := listDir(t, dir); !slices.Equal(got, want) {
+		t.Fatalf("expected files %v, got %v", want, got)
+	}
+	for i, name := range want {
+		events := readLog(t, filepath.Join(dir, name))
+		if len(events) != 2 {
+			t.Fatalf("%s: expected a header and an event, got %+v", name, events)
+		}
+		if events[0].Type != "HEADER" || events[0].Header.Labels["app"] != "test" {
+			t.Errorf("%s: expected a labelled header first, got %+v", name, events[0])
+		}
+		if wantID := 4 - i; events[1].ID != wantID {
+			t.Errorf("%s: expected ID %d, got %d", name, wantID, events[1].ID)
+		}
+	}
+}
+
+func TestRotatingFile_Age(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	f, err := NewRotatingFile(path, WithMaxAge(time.Hour), WithoutHeader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	f.Log(Event{Type: "LOCK", State: "START", ID: 1, Ts: now.UnixNano()})
+	f.Log(Event{Type: "LOCK", State: "ACQUIRED", ID: 1, Ts: now.Add(time.Minute).UnixNano()})
+	f.Log(Event{Type: "LOCK", State: "RELEASED", ID: 1, Ts: now.Add(2 * time.Hour).UnixNano()})
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(readLog(t, path+".1")); got != 2 {
+		t.Errorf("expected 2 events before the rotation, got %d", got)
+	}
+	events := readLog(t, path)
+	if len(events) != 1 || events[0].State != "RELEASED" {
+		t.Errorf("expected the RELEASED event after the rotation, got %+v", events)
+	}
+}
+
+func TestRotatingFile_Append(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	for range 2 {
+		f, err := NewRotatingFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Log(Event{Type: "LOCK", State: "START", ID: 1, Ts: time.Now().UnixNano()})
+		if err := f.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Log(Event{Type: "LOCK", State: "ACQUIRED", ID: 1})
+	}
+
+	// Each run rotated its file away, leaving an empty live file.
+	want := []string{"app.log", "app.log.1", "app.log.2"}
+	if got := listDir(t, dir); !slices.Equal(got, want) {
+		t.Fatalf("expected files %v, got %v", want, got)
+	}
+	if events := readLog(t, path); len(events) != 0 {
+		t.Errorf("expected no events after Close, got %+v", events)
+	}
+}
+
+func TestRotatingFile_Traces(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	f, err := NewRotatingFile(path, WithMaxSize(1), WithoutHeader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := InternTraces(f.Log)
+	for id := 1; id <= 3; id++ {
+		logger(Event{Type: "LOCK", State: "START", ID: id, Trace: "main.go:10"})
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stack is only interned once, but every file defines it.
+	for _, name := range []string{"app.log", "app.log.1", "app.log.2"} {
+		events := readLog(t, filepath.Join(dir, name))
+		if len(events) != 2 || events[0].Type != "TRACE" || events[0].TraceID != events[1].TraceID {
+			t.Errorf("%s: expected the TRACE definition before its event, got %+v", name, events)
+		}
+	}
+}
+
+func TestRotatingFile_SizeCountsHeader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	e := Event{Type: "LOCK", State: "START", ID: 1, Ts: time.Now().UnixNano()}
+	line, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(line, '\n'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The event fits next to the previous run's, but not with a header.
+	limit := int64(2*len(line) + 2)
+	f, err := NewRotatingFile(path, WithMaxSize(limit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Log(e)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readLog(t, path+".1"); len(got) != 1 {
+		t.Errorf("expected the previous run's event alone in the rotated file, got %+v", got)
+	}
+	if got := readLog(t, path); len(got) != 2 || got[0].Type != "HEADER" {
+		t.Errorf("expected a header and the event in the new file, got %+v", got)
+	}
+}
+
+func TestRotatingFile_AgeOfExisting(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	now := time.Now()
+	old := Event{Type: "LOCK", State: "START", ID: 1, Ts: now.Add(-2 * time.Hour).UnixNano()}
+	line, err := json.Marshal(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(line, '\n'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening the file doesn't restart its age.
+	f, err := NewRotatingFile(path, WithMaxAge(time.Hour), WithoutHeader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Log(Event{Type: "LOCK", State: "START", ID: 2, Ts: now.UnixNano()})
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readLog(t, path); len(got) != 1 || got[0].ID != 2 {
+		t.Errorf("expected the file to be rotated before ID 2, got %+v", got)
+	}
+}
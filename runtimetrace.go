@@ -0,0 +1,58 @@
+package deadlog
+
+import (
+	"context"
+	"fmt"
+	"runtime/trace"
+)
+
+// traceCategory is the runtime/trace log category for deadlog events.
+const traceCategory = "deadlog"
+
+// traceLog records a lock event in the runtime execution trace, if enabled
+// with WithRuntimeTrace and a trace is being collected.
+func (m *Mutex) traceLog(typ, state string, id int, name string) {
+	if !m.runtimeTrace || !trace.IsEnabled() {
+		return
+	}
+	msg := fmt.Sprintf("%s %s %s ID: %d", typ, state, name, id)
+	if name != m.name {
+		msg += " mutex: " + m.name
+	}
+	trace.Log(context.Background(), traceCategory, msg)
+}
+
+// startWait starts a runtime/trace region for a wait on name. It returns nil
+// if runtime tracing is off. Waits start and end in the same Mutex method,
+// so they are always on one goroutine, as regions must be.
+func (m *Mutex) startWait(name string) *trace.Region {
+	if !m.runtimeTrace || !trace.IsEnabled() {
+		return nil
+	}
+	return trace.StartRegion(context.Background(), "deadlog.wait "+name)
+}
+
+// endWait ends a region returned by startWait.
+func endWait(r *trace.Region) {
+	if r != nil {
+		r.End()
+	}
+}
+
+// startHold starts a runtime/trace task for a hold of name. Unlike a
+// region, a task may be ended on another goroutine, as unlocks often are.
+// It returns nil if runtime tracing is off.
+func (m *Mutex) startHold(name string) *trace.Task {
+	if !m.runtimeTrace || !trace.IsEnabled() {
+		return nil
+	}
+	_, task := trace.NewTask(context.Background(), "deadlog.hold "+name)
+	return task
+}
+
+// endHold ends a task returned by startHold.
+func endHold(t *trace.Task) {
+	if t != nil {
+		t.End()
+	}
+}
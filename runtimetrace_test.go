@@ -0,0 +1,60 @@
+package deadlog
+
+import (
+	"bytes"
+	"runtime/trace"
+	"testing"
+)
+
+func TestMutex_WithRuntimeTrace(t *testing.T) {
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Skipf("runtime trace unavailable: %v", err)
+	}
+	m := New(WithName("traced-mutex"), WithLogger(func(Event) {}), WithRuntimeTrace())
+	m.Lock()
+	m.Unlock()
+	unlock := m.LockFunc(WithLockName("traced-callsite"))
+	unlock()
+	m.RLock()
+	m.RUnlock()
+	// Holds may end on another goroutine.
+	m.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Unlock()
+	}()
+	<-done
+	trace.Stop()
+
+	out := buf.Bytes()
+	for _, want := range []string{
+		"deadlog.wait traced-mutex",
+		"deadlog.hold traced-mutex",
+		"deadlog.wait traced-callsite",
+		"deadlog.hold traced-callsite",
+		"LOCK ACQUIRED traced-callsite",
+		"mutex: traced-mutex",
+		"RWLOCK START traced-mutex",
+	} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("trace should contain %q", want)
+		}
+	}
+}
+
+func TestMutex_WithoutRuntimeTrace(t *testing.T) {
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Skipf("runtime trace unavailable: %v", err)
+	}
+	m := New(WithName("untraced-mutex"), WithLogger(func(Event) {}))
+	unlock := m.LockFunc()
+	unlock()
+	trace.Stop()
+
+	if bytes.Contains(buf.Bytes(), []byte("untraced-mutex")) {
+		t.Error("trace should not mention mutexes without WithRuntimeTrace")
+	}
+}
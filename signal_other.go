@@ -0,0 +1,9 @@
+//go:build !unix
+
+package deadlog
+
+import "os"
+
+// defaultDumpSignal is the signal HandleSignal listens for by default. There
+// is no SIGUSR1 here, so a signal must be given.
+var defaultDumpSignal os.Signal
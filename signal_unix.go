@@ -0,0 +1,11 @@
+//go:build unix
+
+package deadlog
+
+import (
+	"os"
+	"syscall"
+)
+
+// defaultDumpSignal is the signal HandleSignal listens for by default.
+var defaultDumpSignal os.Signal = syscall.SIGUSR1
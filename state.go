@@ -0,0 +1,222 @@
+package deadlog
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"slices"
+	"sync"
+	"time"
+)
+
+// WithGoroutineStacks adds the stacks of all goroutines to state dumps, see
+// WriteState.
+func WithGoroutineStacks() LoggerOption {
+	return func(o *loggerOpts) {
+		o.goroutines = true
+	}
+}
+
+// WithFlightRecorder saves the contents of a running runtime/trace flight
+// recorder with each state dump that HandleSignal writes to a file, as a
+// .trace file next to it for go tool trace. Combined with WithRuntimeTrace,
+// it shows what led up to the dump.
+func WithFlightRecorder(fr *trace.FlightRecorder) LoggerOption {
+	return func(o *loggerOpts) {
+		o.flightRecorder = fr
+	}
+}
+
+// WithDumpDir sets the directory HandleSignal writes state dumps to. The
+// default is os.TempDir().
+func WithDumpDir(dir string) LoggerOption {
+	return func(o *loggerOpts) {
+		o.dumpDir = dir
+	}
+}
+
+// WriteState writes the operations that are outstanding right now, as JSON
+// events that deadlog analyze reads like any log: a HEADER, a START for
+// every waiting operation and a START and an ACQUIRED for every held one.
+// Only operations started while the state is tracked are known, see
+// TrackState and HandleSignal; without either the dump has none. Mutexes
+// needn't be created WithProfile. Since the dump shows which locks are held,
+// holds taken with Lock and RLock are written as the tracked types LOCK and
+// RLOCK so that the analyzer reports them. With WithGoroutineStacks, the
+// stacks of all goroutines follow in the Go traceback format, for deadlog
+// analyze --goroutines.
+func WriteState(w io.Writer, opts ...LoggerOption) error {
+	var o loggerOpts
+	for _, opt := range opts {
+		opt(&o)
+	}
+	enc := json.NewEncoder(w)
+	if !o.noHeader {
+		if err := enc.Encode(HeaderEvent(NewHeader(o.labels))); err != nil {
+			return err
+		}
+	}
+
+	outstanding.mu.Lock()
+	ops := make([]profileOp, 0, len(outstanding.ops))
+	for op := range outstanding.ops {
+		ops = append(ops, *op)
+	}
+	outstanding.mu.Unlock()
+	slices.SortFunc(ops, func(a, b profileOp) int {
+		return cmp.Compare(a.start, b.start)
+	})
+
+	for _, op := range ops {
+		typ := op.typ
+		if op.acquired != 0 {
+			switch typ {
+			case "WLOCK":
+				typ = "LOCK"
+			case "RWLOCK":
+				typ = "RLOCK"
+			}
+		}
+		e := Event{
+			Type:      typ,
+			State:     "START",
+			Name:      op.name,
+			ID:        op.id,
+			Ts:        op.start,
+			Frames:    pcFrames(op.pcs),
+			Goroutine: op.goroutine,
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+		if op.acquired == 0 {
+			continue
+		}
+		e.State, e.Ts = "ACQUIRED", op.acquired
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	if o.goroutines {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+		return pprof.Lookup("goroutine").WriteTo(w, 2)
+	}
+	return nil
+}
+
+// pcFrames symbolizes program counters from runtime.Callers.
+func pcFrames(pcs []uintptr) []Frame {
+	if len(pcs) == 0 {
+		return nil
+	}
+	var out []Frame
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		out = append(out, Frame{Func: frame.Function, File: frame.File, Line: frame.Line})
+		if !more {
+			return out
+		}
+	}
+}
+
+// HandleSignal writes a state dump, see WriteState, every time the process
+// receives sig, so a hung process can be inspected without restarting it.
+// A nil sig means SIGUSR1, or no signal where there is none. A nil w writes
+// each dump to a new timestamped file, deadlog-<pid>-<time>.log in the
+// WithDumpDir directory, whose name is printed to stderr; only then is a
+// WithFlightRecorder snapshot saved too.
+//
+// Operations of all mutexes are tracked from the call on, as by TrackState,
+// so a dump reports everything outstanding that started after HandleSignal;
+// install it early, such as at the start of main. The returned function
+// stops handling the signal and tracking.
+func HandleSignal(sig os.Signal, w io.Writer, opts ...LoggerOption) (stop func()) {
+	if sig == nil {
+		sig = defaultDumpSignal
+	}
+	if sig == nil {
+		return func() {}
+	}
+	var o loggerOpts
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	untrack := TrackState()
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, sig)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-c:
+			}
+			var err error
+			if w != nil {
+				err = WriteState(w, opts...)
+			} else {
+				err = dumpState(o, opts)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "deadlog: writing state: %v\n", err)
+			}
+		}
+	}()
+	return sync.OnceFunc(func() {
+		signal.Stop(c)
+		close(done)
+		untrack()
+	})
+}
+
+// dumpState writes a state dump, and a flight recorder snapshot if
+// configured, to new timestamped files.
+func dumpState(o loggerOpts, opts []LoggerOption) error {
+	dir := o.dumpDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	base := filepath.Join(dir, fmt.Sprintf("deadlog-%d-%s", os.Getpid(), time.Now().UTC().Format("20060102T150405.000Z")))
+
+	f, err := os.Create(base + ".log")
+	if err != nil {
+		return err
+	}
+	if err := WriteState(f, opts...); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "deadlog: state written to %s\n", f.Name())
+
+	if fr := o.flightRecorder; fr != nil && fr.Enabled() {
+		f, err := os.Create(base + ".trace")
+		if err != nil {
+			return err
+		}
+		if _, err := fr.WriteTo(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "deadlog: flight recorder written to %s\n", f.Name())
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package deadlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitOutstanding waits until n operations named name are outstanding.
+func waitOutstanding(t *testing.T, name string, n int) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(time.Millisecond) {
+		count := 0
+		outstanding.mu.Lock()
+		for op := range outstanding.ops {
+			if op.name == name {
+				count++
+			}
+		}
+		outstanding.mu.Unlock()
+		if count == n {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %d outstanding %s operations", n, name)
+}
+
+// decodeState decodes the events of a state dump, up to the goroutines.
+func decodeState(t *testing.T, dump string, name string) (header Event, events []Event, rest string) {
+	t.Helper()
+	jsonPart, rest, _ := strings.Cut(dump, "\n\n")
+	for i, line := range strings.Split(jsonPart, "\n") {
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		if i == 0 {
+			header = e
+		} else if e.Name == name {
+			events = append(events, e)
+		}
+	}
+	return header, events, rest
+}
+
+func TestWriteState(t *testing.T) {
+	defer TrackState()()
+	m := New(WithName("write-state"), WithGoroutineID(), WithLogger(nil))
+	unlock := m.LockFunc()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Lock()
+		m.Unlock()
+	}()
+	waitOutstanding(t, "write-state", 2)
+
+	var buf bytes.Buffer
+	if err := WriteState(&buf, WithGoroutineStacks(), WithLabels(map[string]string{"pod": "a"})); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	<-done
+
+	header, events, stacks := decodeState(t, buf.String(), "write-state")
+	if header.Type != "HEADER" || header.Header.Labels["pod"] != "a" {
+		t.Errorf("expected a labelled header first, got %+v", header)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	held, waiting := events[:2], events[2]
+	if held[0].Type != "LOCK" || held[0].State != "START" || held[1].State != "ACQUIRED" || held[0].ID != held[1].ID {
+		t.Errorf("expected START and ACQUIRED of the held lock, got %+v", held)
+	}
+	if waiting.Type != "WLOCK" || waiting.State != "START" {
+		t.Errorf("expected START of the waiting Lock, got %+v", waiting)
+	}
+	if len(held[0].Frames) == 0 || held[0].Frames[0].Func != "github.com/stevenctl/deadlog.TestWriteState" {
+		t.Errorf("expected the stack of the caller, got %+v", held[0].Frames)
+	}
+	if held[0].Goroutine != goroutineID() || waiting.Goroutine == 0 || waiting.Goroutine == held[0].Goroutine {
+		t.Errorf("expected goroutine IDs of the holder and the waiter, got %d and %d", held[0].Goroutine, waiting.Goroutine)
+	}
+	if !strings.Contains(stacks, "goroutine ") || !strings.Contains(stacks, "sync.(*RWMutex).Lock") {
+		t.Errorf("expected goroutine stacks after the events, got %q", stacks)
+	}
+}
+
+func TestWriteState_Untracked(t *testing.T) {
+	defer TrackState()()
+	m := New(WithName("write-state-untracked"), WithLogger(nil))
+	m.Lock()
+	defer m.Unlock()
+
+	var buf bytes.Buffer
+	if err := WriteState(&buf, WithoutHeader()); err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Name == "write-state-untracked" {
+			types = append(types, e.Type+" "+e.State)
+		}
+	}
+	if strings.Join(types, ",") != "LOCK START,LOCK ACQUIRED" {
+		t.Errorf("expected the Lock hold as LOCK, got %v", types)
+	}
+}
+
+func TestWriteState_NotTracked(t *testing.T) {
+	m := New(WithName("write-state-not-tracked"), WithProfile(), WithLogger(nil))
+	m.Lock()
+	var buf bytes.Buffer
+	err := WriteState(&buf, WithoutHeader())
+	m.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "write-state-not-tracked") {
+		t.Errorf("expected no operations started before tracking, got:\n%s", buf.String())
+	}
+
+	stop := TrackState()
+	unlock := m.RLockFunc()
+	stop()
+	stop() // stopping twice is harmless
+	if stateTracking.Load() != 0 {
+		t.Errorf("expected tracking to stop, got %d", stateTracking.Load())
+	}
+	buf.Reset()
+	if err := WriteState(&buf, WithoutHeader()); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if !strings.Contains(buf.String(), "write-state-not-tracked") {
+		t.Errorf("expected the operation started while tracking, got:\n%s", buf.String())
+	}
+	waitOutstanding(t, "write-state-not-tracked", 0)
+}
@@ -0,0 +1,73 @@
+//go:build unix
+
+package deadlog
+
+import (
+	"os"
+	"path/filepath"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleSignal(t *testing.T) {
+	fr := trace.NewFlightRecorder(trace.FlightRecorderConfig{})
+	if err := fr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Stop()
+
+	dir := t.TempDir()
+	stop := HandleSignal(nil, nil, WithDumpDir(dir), WithFlightRecorder(fr))
+	defer stop()
+
+	// Mutexes needn't be created WithProfile once the handler is installed.
+	m := New(WithName("handle-signal"), WithLogger(nil))
+	unlock := m.LockFunc()
+	defer unlock()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+
+	var dumps []string
+	for start := time.Now(); len(dumps) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("timed out waiting for the state dump")
+		}
+		dumps, _ = filepath.Glob(filepath.Join(dir, "deadlog-*.log"))
+	}
+	// The file is written in place; wait for the held lock to show up.
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		data, err := os.ReadFile(dumps[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), `"name":"handle-signal"`) {
+			_, events, _ := decodeState(t, strings.TrimSpace(string(data)), "handle-signal")
+			if len(events) != 2 || events[1].State != "ACQUIRED" {
+				t.Errorf("expected the held lock, got %+v", events)
+			}
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("expected the held lock in the dump, got:\n%s", data)
+		}
+	}
+	if !strings.HasPrefix(filepath.Base(dumps[0]), "deadlog-"+strconv.Itoa(os.Getpid())+"-") {
+		t.Errorf("expected the PID in the file name, got %s", dumps[0])
+	}
+
+	// The flight recorder snapshot is written after the dump.
+	tracePath := strings.TrimSuffix(dumps[0], ".log") + ".trace"
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if info, err := os.Stat(tracePath); err == nil && info.Size() > 0 {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("expected a flight recorder snapshot at %s", tracePath)
+		}
+	}
+}